@@ -0,0 +1,155 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hq-cml/go-unittest/common"
+)
+
+//存储中的key为keyPrefix+电影名
+const keyPrefix = "movie:"
+
+//List每次Scan的个数
+const listBatch = 100
+
+//Add的电影已经存在
+var ErrExists = errors.New("catalog: movie already exists")
+
+//把common.Movie编码后存放在任意的StorageClient中
+//StorageClient和Codec都由外部传入，方便用gomock替换，或者用RealClient之类的内存实现当作fake
+type MovieCatalog struct {
+	client common.StorageClient
+	codec  common.Codec
+}
+
+//codec为nil时使用JSON
+func NewMovieCatalog(client common.StorageClient, codec common.Codec) *MovieCatalog {
+	if codec == nil {
+		codec = common.JSONCodec{}
+	}
+	return &MovieCatalog{client: client, codec: codec}
+}
+
+//新增一部电影，写入前先校验，已经存在返回ErrExists
+//client支持原子操作(AtomicStorageClient)时用GetOrSet一步完成，并发Add同一部电影只有一个成功
+//否则退化成Exists->Set两步，不是原子的：并发Add同一部电影可能都成功，后写入的覆盖先写入的
+//只看client本身是否实现了AtomicStorageClient，RecordingClient等装饰器包装的RealClient也走非原子的方式，Update同理
+func (c *MovieCatalog) Add(m common.Movie) error {
+	data, err := c.encode(m)
+	if err != nil {
+		return err
+	}
+	key := keyPrefix + m.Name
+	if ac, ok := c.client.(common.AtomicStorageClient); ok {
+		_, loaded, err := ac.GetOrSet(key, data)
+		if err != nil {
+			return err
+		}
+		if loaded {
+			return fmt.Errorf("%w: %q", ErrExists, m.Name)
+		}
+		return nil
+	}
+	if c.client.Exists(key) {
+		return fmt.Errorf("%w: %q", ErrExists, m.Name)
+	}
+	return c.client.Set(key, data)
+}
+
+//按名字查询，不存在返回*common.NotFoundError
+func (c *MovieCatalog) Get(name string) (common.Movie, error) {
+	v, ok := c.client.Get(keyPrefix + name)
+	if !ok {
+		return common.Movie{}, &common.NotFoundError{Key: name}
+	}
+	return c.decode(name, v)
+}
+
+//覆盖已有的电影，写入前先校验，不存在返回*common.NotFoundError
+//client支持原子操作时先Get再CompareAndSwap，期间被其他人修改则重新读取，被删除则返回*common.NotFoundError
+//否则退化成Exists->Set两步，不是原子的：和Delete并发时可能把刚被删除的电影重新写回去
+func (c *MovieCatalog) Update(m common.Movie) error {
+	data, err := c.encode(m)
+	if err != nil {
+		return err
+	}
+	key := keyPrefix + m.Name
+	if ac, ok := c.client.(common.AtomicStorageClient); ok {
+		for {
+			old, ok := ac.Get(key)
+			if !ok {
+				return &common.NotFoundError{Key: m.Name}
+			}
+			swapped, err := ac.CompareAndSwap(key, old, data)
+			if err != nil || swapped {
+				return err
+			}
+		}
+	}
+	if !c.client.Exists(key) {
+		return &common.NotFoundError{Key: m.Name}
+	}
+	return c.client.Set(key, data)
+}
+
+//删除电影，不存在返回*common.NotFoundError
+func (c *MovieCatalog) Delete(name string) error {
+	key := keyPrefix + name
+	if !c.client.Exists(key) {
+		return &common.NotFoundError{Key: name}
+	}
+	return c.client.Delete(key)
+}
+
+//按类型列出电影，按名字的字典序排列，typ为空时列出全部
+//分批Scan，遍历期间被删除的电影会被跳过
+func (c *MovieCatalog) List(typ string) ([]common.Movie, error) {
+	var movies []common.Movie
+	cursor := ""
+	for {
+		keys, next, err := c.client.Scan(keyPrefix, cursor, listBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			v, ok := c.client.Get(key)
+			if !ok {
+				continue
+			}
+			m, err := c.decode(key[len(keyPrefix):], v)
+			if err != nil {
+				return nil, err
+			}
+			if typ == "" || m.Type == typ {
+				movies = append(movies, m)
+			}
+		}
+		if next == "" {
+			//Scan的顺序由后端决定，不一定是名字的顺序
+			sort.Slice(movies, func(i, j int) bool { return movies[i].Name < movies[j].Name })
+			return movies, nil
+		}
+		cursor = next
+	}
+}
+
+func (c *MovieCatalog) encode(m common.Movie) (string, error) {
+	if err := m.Validate(); err != nil {
+		return "", err
+	}
+	data, err := c.codec.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("catalog: encode %q: %w", m.Name, err)
+	}
+	return string(data), nil
+}
+
+func (c *MovieCatalog) decode(name, v string) (common.Movie, error) {
+	var m common.Movie
+	if err := c.codec.Unmarshal([]byte(v), &m); err != nil {
+		return common.Movie{}, fmt.Errorf("catalog: decode %q: %w", name, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,320 @@
+package catalog
+
+/*
+ * MovieCatalog依赖StorageClient和Codec两个接口，演示两种测试替身的写法：
+ *   mock：用gomock生成的MockStorageClient、MockCodec，精确地约定每一次调用的参数、返回值和顺序
+ *         适合验证交互本身，例如Add在非原子的client上必须先Exists再Set，或者构造难以复现的错误
+ *   fake：用真正可以工作的轻量实现代替外部依赖，例如内存中的RealClient、LRUClient
+ *         只关心最终的状态，不关心调用细节，重构内部实现时测试不需要跟着改
+ * 一般来说，能用fake的地方优先用fake，mock用来覆盖fake难以触发的分支
+ */
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/hq-cml/go-unittest/common"
+	"github.com/hq-cml/go-unittest/gomock/mocks"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+var titanic = common.Movie{Name: "Titanic", Type: "Love", Score: 95}
+
+//fake：不同的存储和编码组合，行为应该一致
+func TestMovieCatalogFake(t *testing.T) {
+	stores := []struct {
+		name   string
+		client func() common.StorageClient
+	}{
+		{"RealClient", func() common.StorageClient { return common.NewRealClient() }},
+		{"LRUClient", func() common.StorageClient { return common.NewLRUStorageClient(common.LRUConfig{}) }},
+		{"ShardedClient", func() common.StorageClient {
+			return common.NewShardedStorageClient(common.ShardedConfig{Shards: 4})
+		}},
+	}
+	codecs := []common.Format{common.FormatJSON, common.FormatXML, common.FormatGob}
+
+	for _, store := range stores {
+		for _, format := range codecs {
+			codec, _ := common.NewCodec(common.WithFormat(format))
+			c := NewMovieCatalog(store.client(), codec)
+			name := store.name + "/" + string(format)
+
+			if err := c.Add(titanic); err != nil {
+				t.Fatalf("%s: Add() error = %v", name, err)
+			}
+			if err := c.Add(titanic); !errors.Is(err, ErrExists) {
+				t.Errorf("%s: second Add() error = %v, want ErrExists", name, err)
+			}
+			if got, err := c.Get("Titanic"); err != nil || got != titanic {
+				t.Errorf("%s: Get() = %+v, %v, want %+v", name, got, err, titanic)
+			}
+
+			updated := titanic
+			updated.Score = 99
+			if err := c.Update(updated); err != nil {
+				t.Errorf("%s: Update() error = %v", name, err)
+			}
+			if got, _ := c.Get("Titanic"); got != updated {
+				t.Errorf("%s: Get() after Update = %+v, want %+v", name, got, updated)
+			}
+
+			if err := c.Delete("Titanic"); err != nil {
+				t.Errorf("%s: Delete() error = %v", name, err)
+			}
+			if _, err := c.Get("Titanic"); !errors.Is(err, common.ErrNotFound) {
+				t.Errorf("%s: Get() after Delete error = %v, want ErrNotFound", name, err)
+			}
+			if err := c.Delete("Titanic"); !errors.Is(err, common.ErrNotFound) {
+				t.Errorf("%s: second Delete() error = %v, want ErrNotFound", name, err)
+			}
+			if err := c.Update(updated); !errors.Is(err, common.ErrNotFound) {
+				t.Errorf("%s: Update() missing error = %v, want ErrNotFound", name, err)
+			}
+		}
+	}
+}
+
+func TestMovieCatalogList(t *testing.T) {
+	convey.Convey("TestMovieCatalogList", t, func() {
+		client := common.NewRealClient()
+		c := NewMovieCatalog(client, nil)
+
+		convey.Convey("empty", func() {
+			movies, err := c.List("")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(movies, convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("more than one batch, filtered by type", func() {
+			for i := 0; i < 2*listBatch+50; i++ {
+				typ := "Love"
+				if i%5 == 0 {
+					typ = "Horror"
+				}
+				name := "m" + strconv.Itoa(1000+i)
+				convey.So(c.Add(common.Movie{Name: name, Type: typ, Score: i % 101}), convey.ShouldBeNil)
+			}
+			//其他前缀的key不受影响
+			client.Set("other", "x")
+
+			all, err := c.List("")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(all), convey.ShouldEqual, 2*listBatch+50)
+			convey.So(all[0].Name, convey.ShouldEqual, "m1000")
+			convey.So(all[len(all)-1].Name, convey.ShouldEqual, "m1249")
+
+			horror, err := c.List("Horror")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(horror), convey.ShouldEqual, 50)
+			for _, m := range horror {
+				convey.So(m.Type, convey.ShouldEqual, "Horror")
+			}
+		})
+
+		convey.Convey("corrupt value", func() {
+			client.Set(keyPrefix+"bad", "{not json")
+			_, err := c.List("")
+			convey.So(err, convey.ShouldNotBeNil)
+			_, err = c.Get("bad")
+			convey.So(err.Error(), convey.ShouldStartWith, `catalog: decode "bad": `)
+		})
+	})
+}
+
+func TestMovieCatalogValidation(t *testing.T) {
+	c := NewMovieCatalog(common.NewRealClient(), nil)
+	invalid := []common.Movie{
+		{Type: "Love", Score: 1},
+		{Name: "a", Type: "Unknown", Score: 1},
+		{Name: "a", Type: "Love", Score: 101},
+	}
+	for _, m := range invalid {
+		if err := c.Add(m); !errors.Is(err, common.ErrInvalid) {
+			t.Errorf("Add(%+v) error = %v, want ErrInvalid", m, err)
+		}
+	}
+	c.Add(titanic)
+	bad := titanic
+	bad.Score = -1
+	if err := c.Update(bad); !errors.Is(err, common.ErrInvalid) {
+		t.Errorf("Update(%+v) error = %v, want ErrInvalid", bad, err)
+	}
+	if got, _ := c.Get("Titanic"); got != titanic {
+		t.Errorf("invalid Update changed the movie to %+v", got)
+	}
+}
+
+//RealClient实现了AtomicStorageClient，并发Add同一部电影只有一个成功
+func TestMovieCatalogConcurrentAdd(t *testing.T) {
+	c := NewMovieCatalog(common.NewRealClient(), nil)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	added := 0
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m := titanic
+			m.Score = i
+			err := c.Add(m)
+			if err != nil && !errors.Is(err, ErrExists) {
+				t.Errorf("Add() error = %v", err)
+			}
+			if err == nil {
+				mu.Lock()
+				added++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if added != 1 {
+		t.Errorf("%d concurrent Add succeeded, want 1", added)
+	}
+}
+
+//装饰器没有实现AtomicStorageClient，包装RealClient之后Add、Update走非原子的方式
+func TestMovieCatalogWrappedClient(t *testing.T) {
+	rec := common.NewRecordingClient(common.NewRealClient())
+	c := NewMovieCatalog(rec, nil)
+	if err := c.Add(titanic); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := c.Update(titanic); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	var methods []string
+	for _, in := range rec.Cassette().Interactions {
+		methods = append(methods, in.Method)
+	}
+	want := []string{"Exists", "Set", "Exists", "Set"}
+	if strings.Join(methods, ",") != strings.Join(want, ",") {
+		t.Errorf("Add() and Update() on a wrapped RealClient called %v, want %v", methods, want)
+	}
+}
+
+//mock：约定对StorageClient和Codec的每一次调用
+func TestMovieCatalogMock(t *testing.T) {
+	convey.Convey("TestMovieCatalogMock", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		data := `{"Name":"Titanic","Type":"Love","Score":95}`
+
+		convey.Convey("add checks existence before set", func() {
+			client := mocks.NewMockStorageClient(ctrl)
+			gomock.InOrder(
+				client.EXPECT().Exists("movie:Titanic").Return(false),
+				client.EXPECT().Set("movie:Titanic", data).Return(nil),
+			)
+			convey.So(NewMovieCatalog(client, nil).Add(titanic), convey.ShouldBeNil)
+		})
+
+		convey.Convey("add uses GetOrSet on atomic clients", func() {
+			client := mocks.NewMockAtomicStorageClient(ctrl)
+			client.EXPECT().GetOrSet("movie:Titanic", data).Return("old", true, nil)
+			err := NewMovieCatalog(client, nil).Add(titanic)
+			convey.So(errors.Is(err, ErrExists), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("update uses CompareAndSwap on atomic clients", func() {
+			client := mocks.NewMockAtomicStorageClient(ctrl)
+			gomock.InOrder(
+				client.EXPECT().Get("movie:Titanic").Return("v1", true),
+				//期间被其他人修改，重新读取
+				client.EXPECT().CompareAndSwap("movie:Titanic", "v1", data).Return(false, nil),
+				client.EXPECT().Get("movie:Titanic").Return("v2", true),
+				client.EXPECT().CompareAndSwap("movie:Titanic", "v2", data).Return(true, nil),
+			)
+			convey.So(NewMovieCatalog(client, nil).Update(titanic), convey.ShouldBeNil)
+		})
+
+		convey.Convey("update fails when deleted concurrently", func() {
+			client := mocks.NewMockAtomicStorageClient(ctrl)
+			gomock.InOrder(
+				client.EXPECT().Get("movie:Titanic").Return("v1", true),
+				client.EXPECT().CompareAndSwap("movie:Titanic", "v1", data).Return(false, nil),
+				client.EXPECT().Get("movie:Titanic").Return("", false),
+			)
+			err := NewMovieCatalog(client, nil).Update(titanic)
+			convey.So(errors.Is(err, common.ErrNotFound), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("storage errors are returned as is", func() {
+			client := mocks.NewMockStorageClient(ctrl)
+			unavailable := &common.UnavailableError{Backend: "mock", Err: errors.New("down")}
+			client.EXPECT().Exists("movie:Titanic").Return(true).Times(2)
+			client.EXPECT().Set(gomock.Any(), gomock.Any()).Return(unavailable)
+			client.EXPECT().Delete("movie:Titanic").Return(unavailable)
+			client.EXPECT().Scan(keyPrefix, "", listBatch).Return(nil, "", unavailable)
+
+			c := NewMovieCatalog(client, nil)
+			convey.So(errors.Is(c.Update(titanic), common.ErrBackendUnavailable), convey.ShouldBeTrue)
+			convey.So(errors.Is(c.Delete("Titanic"), common.ErrBackendUnavailable), convey.ShouldBeTrue)
+			_, err := c.List("")
+			convey.So(errors.Is(err, common.ErrBackendUnavailable), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("list skips keys deleted during the scan", func() {
+			client := mocks.NewMockStorageClient(ctrl)
+			gomock.InOrder(
+				client.EXPECT().Scan(keyPrefix, "", listBatch).Return([]string{"movie:A", "movie:Titanic"}, "movie:Titanic\x00", nil),
+				client.EXPECT().Get("movie:A").Return("", false),
+				client.EXPECT().Get("movie:Titanic").Return(data, true),
+				client.EXPECT().Scan(keyPrefix, "movie:Titanic\x00", listBatch).Return(nil, "", nil),
+			)
+			movies, err := NewMovieCatalog(client, nil).List("")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(movies, convey.ShouldResemble, []common.Movie{titanic})
+		})
+
+		convey.Convey("list sorts by name whatever the scan order", func() {
+			client := mocks.NewMockStorageClient(ctrl)
+			codec := mocks.NewMockCodec(ctrl)
+			//key的顺序和名字的顺序不一致，例如后端按哈希顺序返回
+			gomock.InOrder(
+				client.EXPECT().Scan(keyPrefix, "", listBatch).Return([]string{"movie:b", "movie:c"}, "cursor", nil),
+				client.EXPECT().Scan(keyPrefix, "cursor", listBatch).Return([]string{"movie:a"}, "", nil),
+			)
+			for _, name := range []string{"a", "b", "c"} {
+				name := name
+				client.EXPECT().Get("movie:"+name).Return(name, true)
+				codec.EXPECT().Unmarshal([]byte(name), gomock.Any()).DoAndReturn(func(_ []byte, v interface{}) error {
+					*v.(*common.Movie) = common.Movie{Name: name, Type: "Love"}
+					return nil
+				})
+			}
+			movies, err := NewMovieCatalog(client, codec).List("")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(movies), convey.ShouldEqual, 3)
+			for i, name := range []string{"a", "b", "c"} {
+				convey.So(movies[i].Name, convey.ShouldEqual, name)
+			}
+		})
+
+		convey.Convey("codec errors", func() {
+			client := mocks.NewMockStorageClient(ctrl)
+			codec := mocks.NewMockCodec(ctrl)
+			codec.EXPECT().Marshal(titanic).Return(nil, errors.New("boom"))
+			client.EXPECT().Get("movie:Titanic").Return("payload", true)
+			codec.EXPECT().Unmarshal([]byte("payload"), gomock.Any()).Return(errors.New("bad payload"))
+
+			c := NewMovieCatalog(client, codec)
+			err := c.Add(titanic)
+			convey.So(err.Error(), convey.ShouldEqual, `catalog: encode "Titanic": boom`)
+			_, err = c.Get("Titanic")
+			convey.So(err.Error(), convey.ShouldEqual, `catalog: decode "Titanic": bad payload`)
+		})
+
+		convey.Convey("invalid movies never reach the storage", func() {
+			client := mocks.NewMockStorageClient(ctrl)
+			codec := mocks.NewMockCodec(ctrl)
+			err := NewMovieCatalog(client, codec).Add(common.Movie{Name: "a"})
+			convey.So(errors.Is(err, common.ErrInvalid), convey.ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,368 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//cassette文件的版本
+const CassetteVersion = 1
+
+//回放时遇到没有录制过的调用
+var ErrNotRecorded = errors.New("storage: call not recorded in cassette")
+
+//一次调用及其结果
+type Interaction struct {
+	Method string   `json:"method"`
+	Args   []string `json:"args"`
+	Values []string `json:"values,omitempty"` //Get的值，Keys、Scan返回的key
+	Found  bool     `json:"found,omitempty"`  //Get、Exists是否命中
+	Next   string   `json:"next,omitempty"`   //Scan返回的游标
+	Error  string   `json:"error,omitempty"`
+	//错误的具体类型，回放时据此还原错误，没有时(比如旧版本录制的cassette)回放为errors.New(Error)
+	ErrorDetail *RecordedError `json:"error_detail,omitempty"`
+}
+
+//录制下来的错误，回放时还原成同样类型的错误，errors.Is、errors.As的结果和录制时一致
+//Kind为NotFoundError、ValueMismatchError、UnavailableError时还原成对应的类型
+//Kind为ErrNotFound等哨兵错误的名字时，还原成该哨兵错误，或者包装了该哨兵错误、文字为Message的错误
+//Kind为空表示无法识别的错误，还原成errors.New(Message)
+type RecordedError struct {
+	Kind     string         `json:"kind,omitempty"`
+	Message  string         `json:"message"`
+	Key      string         `json:"key,omitempty"`
+	Expected string         `json:"expected,omitempty"`
+	Actual   string         `json:"actual,omitempty"`
+	Backend  string         `json:"backend,omitempty"`
+	Cause    *RecordedError `json:"cause,omitempty"` //UnavailableError.Err
+}
+
+//可以被识别的哨兵错误，按顺序匹配，更具体的在前面
+var recordedSentinels = []struct {
+	name string
+	err  error
+}{
+	{"ErrInjected", ErrInjected},
+	{"ErrCircuitOpen", ErrCircuitOpen},
+	{"ErrNotRecorded", ErrNotRecorded},
+	{"ErrNotFound", ErrNotFound},
+	{"ErrValueMismatch", ErrValueMismatch},
+	{"ErrBackendUnavailable", ErrBackendUnavailable},
+}
+
+//把err转换成可以保存的形式，err为nil时返回nil
+func recordError(err error) *RecordedError {
+	if err == nil {
+		return nil
+	}
+	rec := &RecordedError{Message: err.Error()}
+	switch e := err.(type) {
+	case *NotFoundError:
+		rec.Kind, rec.Key = "NotFoundError", e.Key
+		return rec
+	case *ValueMismatchError:
+		rec.Kind, rec.Key, rec.Expected, rec.Actual = "ValueMismatchError", e.Key, e.Expected, e.Actual
+		return rec
+	case *UnavailableError:
+		rec.Kind, rec.Backend, rec.Cause = "UnavailableError", e.Backend, recordError(e.Err)
+		return rec
+	}
+	for _, s := range recordedSentinels {
+		if errors.Is(err, s.err) {
+			rec.Kind = s.name
+			break
+		}
+	}
+	return rec
+}
+
+//还原录制下来的错误
+func (rec *RecordedError) err() error {
+	switch rec.Kind {
+	case "NotFoundError":
+		return &NotFoundError{Key: rec.Key}
+	case "ValueMismatchError":
+		return &ValueMismatchError{Key: rec.Key, Expected: rec.Expected, Actual: rec.Actual}
+	case "UnavailableError":
+		e := &UnavailableError{Backend: rec.Backend}
+		if rec.Cause != nil {
+			e.Err = rec.Cause.err()
+		}
+		return e
+	}
+	for _, s := range recordedSentinels {
+		if rec.Kind != s.name {
+			continue
+		}
+		if rec.Message == s.err.Error() {
+			return s.err
+		}
+		return &replayedError{msg: rec.Message, err: s.err}
+	}
+	return errors.New(rec.Message)
+}
+
+//回放的包装了哨兵错误的错误，比如fmt.Errorf("%w: ...", ErrNotRecorded)
+type replayedError struct {
+	msg string
+	err error
+}
+
+func (e *replayedError) Error() string {
+	return e.msg
+}
+
+func (e *replayedError) Unwrap() error {
+	return e.err
+}
+
+//录制下来的一组调用，按调用顺序排列
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+//从文件读取cassette
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("cassette %s: %v", path, err)
+	}
+	if c.Version != CassetteVersion {
+		return nil, fmt.Errorf("cassette %s: unsupported version %d", path, c.Version)
+	}
+	return &c, nil
+}
+
+//把cassette写到文件，目录不存在时自动创建
+func (c *Cassette) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+//包装真实的StorageClient，透传所有调用，并把调用和结果按顺序录制下来
+type RecordingClient struct {
+	c StorageClient
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+func NewRecordingClient(c StorageClient) *RecordingClient {
+	return &RecordingClient{c: c}
+}
+
+func (r *RecordingClient) Get(k string) (string, bool) {
+	v, ok := r.c.Get(k)
+	in := Interaction{Method: "Get", Args: []string{k}, Found: ok}
+	if ok {
+		in.Values = []string{v}
+	}
+	r.record(in, nil)
+	return v, ok
+}
+
+func (r *RecordingClient) Set(k, v string) error {
+	err := r.c.Set(k, v)
+	r.record(Interaction{Method: "Set", Args: []string{k, v}}, err)
+	return err
+}
+
+func (r *RecordingClient) Delete(k string) error {
+	err := r.c.Delete(k)
+	r.record(Interaction{Method: "Delete", Args: []string{k}}, err)
+	return err
+}
+
+func (r *RecordingClient) Exists(k string) bool {
+	ok := r.c.Exists(k)
+	r.record(Interaction{Method: "Exists", Args: []string{k}, Found: ok}, nil)
+	return ok
+}
+
+func (r *RecordingClient) Keys() ([]string, error) {
+	keys, err := r.c.Keys()
+	r.record(Interaction{Method: "Keys", Args: []string{}, Values: keys}, err)
+	return keys, err
+}
+
+func (r *RecordingClient) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	keys, next, err := r.c.Scan(prefix, cursor, limit)
+	r.record(Interaction{
+		Method: "Scan",
+		Args:   []string{prefix, cursor, strconv.Itoa(limit)},
+		Values: keys,
+		Next:   next,
+	}, err)
+	return keys, next, err
+}
+
+//到目前为止录制下来的调用
+func (r *RecordingClient) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Cassette{
+		Version:      CassetteVersion,
+		Interactions: append([]Interaction(nil), r.interactions...),
+	}
+}
+
+//把录制下来的调用写到文件
+func (r *RecordingClient) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+//err为这次调用返回的错误
+func (r *RecordingClient) record(in Interaction, err error) {
+	if err != nil {
+		in.Error = err.Error()
+		in.ErrorDetail = recordError(err)
+	}
+	r.mu.Lock()
+	r.interactions = append(r.interactions, in)
+	r.mu.Unlock()
+}
+
+//按cassette回放调用结果，不访问任何后端
+//方法和参数都相同的调用按录制的顺序依次返回，不同参数之间的先后顺序不要求一致
+//遇到没有录制过(或者已经用完)的调用时，Get、Exists按未命中处理，其他方法返回ErrNotRecorded
+type ReplayClient struct {
+	mu      sync.Mutex
+	pending map[string][]Interaction
+	err     error
+
+	//遇到没有录制过的调用时回调，单测里一般设置成t.Errorf
+	OnMiss func(method string, args []string)
+}
+
+func NewReplayClient(c *Cassette) *ReplayClient {
+	r := &ReplayClient{pending: map[string][]Interaction{}}
+	for _, in := range c.Interactions {
+		id := interactionID(in.Method, in.Args)
+		r.pending[id] = append(r.pending[id], in)
+	}
+	return r
+}
+
+func (r *ReplayClient) Get(k string) (string, bool) {
+	in, ok := r.next("Get", k)
+	if !ok || !in.Found || len(in.Values) == 0 {
+		return "", false
+	}
+	return in.Values[0], true
+}
+
+func (r *ReplayClient) Set(k, v string) error {
+	in, ok := r.next("Set", k, v)
+	if !ok {
+		return ErrNotRecorded
+	}
+	return in.err()
+}
+
+func (r *ReplayClient) Delete(k string) error {
+	in, ok := r.next("Delete", k)
+	if !ok {
+		return ErrNotRecorded
+	}
+	return in.err()
+}
+
+func (r *ReplayClient) Exists(k string) bool {
+	in, ok := r.next("Exists", k)
+	return ok && in.Found
+}
+
+func (r *ReplayClient) Keys() ([]string, error) {
+	in, ok := r.next("Keys")
+	if !ok {
+		return nil, ErrNotRecorded
+	}
+	return in.Values, in.err()
+}
+
+func (r *ReplayClient) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	in, ok := r.next("Scan", prefix, cursor, strconv.Itoa(limit))
+	if !ok {
+		return nil, "", ErrNotRecorded
+	}
+	return in.Values, in.Next, in.err()
+}
+
+//第一次遇到没有录制过的调用时的错误，没有则返回nil
+func (r *ReplayClient) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+//还没有被回放的调用个数，测试结束时不为0说明被测代码少调用了
+func (r *ReplayClient) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, ins := range r.pending {
+		n += len(ins)
+	}
+	return n
+}
+
+func (r *ReplayClient) next(method string, args ...string) (Interaction, bool) {
+	r.mu.Lock()
+	id := interactionID(method, args)
+	ins := r.pending[id]
+	if len(ins) > 0 {
+		r.pending[id] = ins[1:]
+		r.mu.Unlock()
+		return ins[0], true
+	}
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s(%s)", ErrNotRecorded, method, strings.Join(quoteAll(args), ", "))
+	}
+	onMiss := r.OnMiss
+	r.mu.Unlock()
+
+	if onMiss != nil {
+		onMiss(method, args)
+	}
+	return Interaction{}, false
+}
+
+func (in *Interaction) err() error {
+	if in.ErrorDetail != nil {
+		return in.ErrorDetail.err()
+	}
+	if in.Error == "" {
+		return nil
+	}
+	return errors.New(in.Error)
+}
+
+func interactionID(method string, args []string) string {
+	return method + "(" + strings.Join(quoteAll(args), ",") + ")"
+}
+
+func quoteAll(args []string) []string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = strconv.Quote(a)
+	}
+	return quoted
+}
@@ -0,0 +1,232 @@
+package common
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+//go test -gcflags=all=-l ./common/ -run Cassette -record -record-addr 127.0.0.1:6379
+//连接真实的后端重新录制testdata/cassettes下的文件，不加该参数时离线回放
+var record = flag.Bool("record", false, "record cassettes against a real backend instead of replaying them")
+
+//录制时连接的Redis地址，默认取环境变量CASSETTE_RESP_ADDR，都没有设置时退回到进程内的假Redis服务
+//用假服务录制只能验证假服务自己，刷新cassette时应该指定真实的Redis
+var recordAddr = flag.String("record-addr", os.Getenv("CASSETTE_RESP_ADDR"), "address of the Redis server to record against")
+
+//按-record参数返回录制或者回放的client
+//录制模式下用realFn创建真实的后端，done负责保存cassette并释放后端
+//回放模式下done检查所有录制的调用都被用完
+func cassetteClient(t *testing.T, name string, realFn func() (StorageClient, func())) (StorageClient, func()) {
+	path := filepath.Join("testdata", "cassettes", name+".json")
+	if *record {
+		real, closeFn := realFn()
+		rec := NewRecordingClient(real)
+		return rec, func() {
+			closeFn()
+			if err := rec.Save(path); err != nil {
+				t.Fatalf("Save(%s) error = %v", path, err)
+			}
+		}
+	}
+
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("LoadCassette() error = %v, run with -record to create it", err)
+	}
+	replay := NewReplayClient(cassette)
+	replay.OnMiss = func(method string, args []string) {
+		t.Errorf("unrecorded call %s%q, run with -record to refresh %s", method, args, path)
+	}
+	return replay, func() {
+		if n := replay.Remaining(); n != 0 {
+			t.Errorf("%d recorded calls were not replayed", n)
+		}
+	}
+}
+
+//真实后端为RESP服务，录制时需要的网络环境在回放时都不需要
+//连接-record-addr指定的Redis时，先删掉keys，避免库里已有的数据影响录制结果
+func realRESP(t *testing.T, keys ...string) func() (StorageClient, func()) {
+	return func() (StorageClient, func()) {
+		if *recordAddr != "" {
+			t.Logf("recording against %s", *recordAddr)
+			client, err := NewRESPStorageClient(*recordAddr)
+			if err != nil {
+				t.Fatalf("NewRESPStorageClient(%s) error = %v", *recordAddr, err)
+			}
+			for _, k := range keys {
+				if err := client.Delete(k); err != nil {
+					t.Fatalf("Delete(%s) error = %v", k, err)
+				}
+			}
+			return client, func() { client.Close() }
+		}
+		t.Logf("no -record-addr, recording against the in-process fake server")
+		server, client := startRESP(t, NewRealClient())
+		return client, func() {
+			client.Close()
+			server.Close()
+		}
+	}
+}
+
+func TestCassetteIntegration(t *testing.T) {
+	client, done := cassetteClient(t, "basic", realRESP(t, "movie:1", "movie:2", "movie:3", "user:1"))
+	defer done()
+
+	convey.Convey("TestCassetteIntegration", t, func() {
+		convey.So(client.Set("movie:1", "Alien"), convey.ShouldBeNil)
+		convey.So(client.Set("movie:2", "Brazil"), convey.ShouldBeNil)
+		convey.So(client.Set("user:1", "ripley"), convey.ShouldBeNil)
+
+		v, ok := client.Get("movie:1")
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(v, convey.ShouldEqual, "Alien")
+		_, ok = client.Get("movie:3")
+		convey.So(ok, convey.ShouldBeFalse)
+
+		var all []string
+		cursor := ""
+		for {
+			keys, next, err := client.Scan("movie:", cursor, 1)
+			convey.So(err, convey.ShouldBeNil)
+			all = append(all, keys...)
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		//真实的Redis不保证SCAN的顺序
+		sort.Strings(all)
+		convey.So(all, convey.ShouldResemble, []string{"movie:1", "movie:2"})
+
+		convey.So(client.Delete("movie:1"), convey.ShouldBeNil)
+		convey.So(client.Exists("movie:1"), convey.ShouldBeFalse)
+		//同一个调用的结果按录制顺序回放
+		convey.So(client.Set("movie:1", "Aliens"), convey.ShouldBeNil)
+		v, _ = client.Get("movie:1")
+		convey.So(v, convey.ShouldEqual, "Aliens")
+	})
+}
+
+func TestCassette(t *testing.T) {
+	convey.Convey("TestCassette", t, func() {
+		inner := NewRealClient()
+		rec := NewRecordingClient(inner)
+		rec.Set("k1", "v1")
+		rec.Get("k1")
+		rec.Get("k2")
+		rec.Set("k1", "v2")
+		rec.Get("k1")
+		rec.Keys()
+
+		dir, err := ioutil.TempDir("", "cassette")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "cassettes", "rec.json")
+		convey.So(rec.Save(path), convey.ShouldBeNil)
+		cassette, err := LoadCassette(path)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(cassette, convey.ShouldResemble, rec.Cassette())
+		convey.So(len(cassette.Interactions), convey.ShouldEqual, 6)
+
+		convey.Convey("replay", func() {
+			replay := NewReplayClient(cassette)
+			//k2和k1之间的先后顺序可以和录制时不同
+			_, ok := replay.Get("k2")
+			convey.So(ok, convey.ShouldBeFalse)
+			convey.So(replay.Set("k1", "v1"), convey.ShouldBeNil)
+			v, _ := replay.Get("k1")
+			convey.So(v, convey.ShouldEqual, "v1")
+			convey.So(replay.Set("k1", "v2"), convey.ShouldBeNil)
+			v, _ = replay.Get("k1")
+			convey.So(v, convey.ShouldEqual, "v2")
+			keys, err := replay.Keys()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"k1"})
+			convey.So(replay.Remaining(), convey.ShouldEqual, 0)
+			convey.So(replay.Err(), convey.ShouldBeNil)
+		})
+
+		convey.Convey("unrecorded call", func() {
+			replay := NewReplayClient(cassette)
+			var missed []string
+			replay.OnMiss = func(method string, args []string) {
+				missed = append(missed, method+" "+strings.Join(args, " "))
+			}
+
+			convey.So(errors.Is(replay.Set("k1", "other"), ErrNotRecorded), convey.ShouldBeTrue)
+			convey.So(replay.Exists("k1"), convey.ShouldBeFalse)
+			//录制的Get已经用完
+			replay.Get("k1")
+			replay.Get("k1")
+			_, ok := replay.Get("k1")
+			convey.So(ok, convey.ShouldBeFalse)
+
+			convey.So(missed, convey.ShouldResemble, []string{"Set k1 other", "Exists k1", "Get k1"})
+			convey.So(errors.Is(replay.Err(), ErrNotRecorded), convey.ShouldBeTrue)
+			convey.So(replay.Err().Error(), convey.ShouldContainSubstring, `Set("k1", "other")`)
+		})
+
+		convey.Convey("recorded error", func() {
+			failing := NewRecordingClient(NewFaultClient(inner, FaultConfig{Rules: []FaultRule{{ErrorRate: 1}}}))
+			failing.Set("k1", "v1")
+			replay := NewReplayClient(failing.Cassette())
+			convey.So(replay.Set("k1", "v1").Error(), convey.ShouldEqual, ErrInjected.Error())
+		})
+
+		convey.Convey("recorded errors keep their types", func() {
+			cause := fmt.Errorf("%w: dial tcp", ErrInjected)
+			errs := []error{
+				&NotFoundError{Key: "k1"},
+				&ValueMismatchError{Key: "k1", Expected: "a", Actual: "b"},
+				&UnavailableError{Backend: "resp 127.0.0.1:6379", Err: cause},
+				ErrCircuitOpen,
+				fmt.Errorf("%w: Get(\"k1\")", ErrNotRecorded),
+				errors.New("something else"),
+			}
+			script := &scriptedClient{StorageClient: inner, script: errs}
+			failing := NewRecordingClient(script)
+			for range errs {
+				failing.Set("k1", "v1")
+			}
+			convey.So(failing.Save(path), convey.ShouldBeNil)
+			cassette, err := LoadCassette(path)
+			convey.So(err, convey.ShouldBeNil)
+			replay := NewReplayClient(cassette)
+
+			got := make([]error, len(errs))
+			for i := range errs {
+				got[i] = replay.Set("k1", "v1")
+				convey.So(got[i].Error(), convey.ShouldEqual, errs[i].Error())
+			}
+			var nf *NotFoundError
+			convey.So(errors.As(got[0], &nf), convey.ShouldBeTrue)
+			convey.So(nf.Key, convey.ShouldEqual, "k1")
+			var vm *ValueMismatchError
+			convey.So(errors.As(got[1], &vm), convey.ShouldBeTrue)
+			convey.So(*vm, convey.ShouldResemble, *errs[1].(*ValueMismatchError))
+			var ue *UnavailableError
+			convey.So(errors.As(got[2], &ue), convey.ShouldBeTrue)
+			convey.So(ue.Backend, convey.ShouldEqual, "resp 127.0.0.1:6379")
+			convey.So(errors.Is(got[2], ErrInjected), convey.ShouldBeTrue)
+			convey.So(got[3] == ErrCircuitOpen, convey.ShouldBeTrue)
+			convey.So(errors.Is(got[4], ErrNotRecorded), convey.ShouldBeTrue)
+			for _, sentinel := range []error{ErrNotFound, ErrValueMismatch, ErrBackendUnavailable, ErrNotRecorded} {
+				convey.So(errors.Is(got[5], sentinel), convey.ShouldBeFalse)
+			}
+			convey.So(errors.Is(got[0], ErrNotFound), convey.ShouldBeTrue)
+			convey.So(errors.Is(got[1], ErrValueMismatch), convey.ShouldBeTrue)
+			convey.So(errors.Is(got[3], ErrBackendUnavailable), convey.ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,50 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+//时钟抽象，需要和时间打交道的地方都通过它取当前时间
+//单测里换成FakeClock，就可以手动拨动时间，不必sleep，也不必用gomonkey去打桩time.Now
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+//默认时钟，即系统时间
+var SystemClock Clock = systemClock{}
+
+//手动拨动的时钟，并发安全
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+//时间向前拨动d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+//把时间向前拨动d，不真正等待
+//可以作为需要sleep的地方的替身，例如RetryConfig.Sleep
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
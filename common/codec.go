@@ -0,0 +1,179 @@
+package common
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+type Encoder interface {
+	Marshal(interface{}) ([]byte, error)
+}
+
+//同一种格式的编码和解码，Unmarshal(Marshal(v))应该得到和v相等的值
+type Codec interface {
+	Encoder
+	Decoder
+}
+
+//默认使用JSON
+func NewEncoder() Encoder {
+	return JSONCodec{}
+}
+
+//编码格式
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatXML  Format = "xml"
+	FormatGob  Format = "gob"
+	FormatCSV  Format = "csv"
+)
+
+//不支持的格式或者Content-Type
+var ErrUnsupportedFormat = errors.New("codec: unsupported format")
+
+//根据Content-Type判断编码格式，忽略charset等参数，也支持application/*+json、application/*+xml
+func FormatForContentType(contentType string) (Format, error) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("%w: content type %q: %v", ErrUnsupportedFormat, contentType, err)
+	}
+	switch {
+	case mt == "application/json" || mt == "text/json" || strings.HasSuffix(mt, "+json"):
+		return FormatJSON, nil
+	case mt == "application/xml" || mt == "text/xml" || strings.HasSuffix(mt, "+xml"):
+		return FormatXML, nil
+	case mt == "application/x-gob" || mt == "application/gob":
+		return FormatGob, nil
+	case mt == "text/csv":
+		return FormatCSV, nil
+	}
+	return "", fmt.Errorf("%w: content type %q", ErrUnsupportedFormat, contentType)
+}
+
+//NewCodec的可选配置，后设置的覆盖先设置的
+type CodecOption func(*codecOptions)
+
+type codecOptions struct {
+	format   Format
+	strict   bool
+	validate bool
+	err      error
+}
+
+//指定编码格式，默认为FormatJSON
+func WithFormat(f Format) CodecOption {
+	return func(o *codecOptions) {
+		o.format = f
+		o.err = nil
+	}
+}
+
+//按Content-Type选择编码格式，不支持时NewCodec返回错误
+func WithContentType(contentType string) CodecOption {
+	return func(o *codecOptions) {
+		o.format, o.err = FormatForContentType(contentType)
+	}
+}
+
+//解码JSON时出现Movie等目标类型没有的字段返回错误，对其他格式不起作用
+func WithDisallowUnknownFields() CodecOption {
+	return func(o *codecOptions) {
+		o.strict = true
+	}
+}
+
+//Unmarshal之后按validate tag校验，见Validate
+func WithValidation() CodecOption {
+	return func(o *codecOptions) {
+		o.validate = true
+	}
+}
+
+//按配置选择Codec，格式不支持时返回ErrUnsupportedFormat
+func NewCodec(opts ...CodecOption) (Codec, error) {
+	o := codecOptions{format: FormatJSON}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.err != nil {
+		return nil, o.err
+	}
+	var c Codec
+	switch o.format {
+	case FormatJSON:
+		c = JSONCodec{DisallowUnknownFields: o.strict}
+	case FormatXML:
+		c = XMLCodec{}
+	case FormatGob:
+		c = GobCodec{}
+	case FormatCSV:
+		c = CSVCodec{}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, o.format)
+	}
+	if o.validate {
+		c = validatingCodec{c, validatingDecoder{c}}
+	}
+	return c, nil
+}
+
+//encoding/json
+type JSONCodec struct {
+	DisallowUnknownFields bool //解码时出现未知字段返回错误
+}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (c JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	if !c.DisallowUnknownFields {
+		return json.Unmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	//和json.Unmarshal保持一致，后面不能再有其他数据
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("json: trailing data after top-level value")
+	}
+	return nil
+}
+
+//encoding/xml，解码时只解析第一个根元素
+//XML 1.0不能表示大部分控制字符，字符串中含有这些字符时无法原样往返
+type XMLCodec struct{}
+
+func (XMLCodec) Marshal(v interface{}) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+func (XMLCodec) Unmarshal(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+//encoding/gob，每次Marshal的结果都带有完整的类型信息，可以单独解码
+type GobCodec struct{}
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
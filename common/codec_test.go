@@ -0,0 +1,54 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestCodec(t *testing.T) {
+	convey.Convey("TestCodec", t, func() {
+		m := Movie{Name: "Titanic", Type: "Love", Score: 9}
+
+		convey.Convey("NewEncoder is json", func() {
+			data, err := NewEncoder().Marshal(m)
+			convey.So(err, convey.ShouldBeNil)
+			want, _ := json.Marshal(m)
+			convey.So(string(data), convey.ShouldEqual, string(want))
+		})
+
+		convey.Convey("xml", func() {
+			c, _ := NewCodec(WithContentType("text/xml"))
+			data, err := c.Marshal(m)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(data), convey.ShouldEqual, "<Movie><Name>Titanic</Name><Type>Love</Type><Score>9</Score></Movie>")
+		})
+
+		convey.Convey("gob output decodes on its own", func() {
+			c, _ := NewCodec(WithFormat(FormatGob))
+			first, _ := c.Marshal(m)
+			second, _ := c.Marshal(m)
+			convey.So(bytes.Equal(first, second), convey.ShouldBeTrue)
+			var got Movie
+			convey.So(c.Unmarshal(second, &got), convey.ShouldBeNil)
+			convey.So(got, convey.ShouldResemble, m)
+		})
+
+		convey.Convey("marshal error", func() {
+			for _, format := range []Format{FormatJSON, FormatXML, FormatGob} {
+				c, _ := NewCodec(WithFormat(format))
+				_, err := c.Marshal(make(chan int))
+				convey.So(err, convey.ShouldNotBeNil)
+			}
+		})
+
+		convey.Convey("unsupported", func() {
+			c, err := NewCodec(WithFormat("yaml"))
+			convey.So(c, convey.ShouldBeNil)
+			convey.So(errors.Is(err, ErrUnsupportedFormat), convey.ShouldBeTrue)
+		})
+	})
+}
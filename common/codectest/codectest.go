@@ -0,0 +1,93 @@
+//Codec的往返测试
+//对随机生成的Movie检查Unmarshal(Marshal(m)) == m，失败时报告随机种子和出错的Movie，方便复现
+package codectest
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hq-cml/go-unittest/common"
+)
+
+//RoundTrip的配置
+type Config struct {
+	Seed   int64 //随机种子，0表示使用当前时间
+	Count  int   //生成的Movie个数，<=0表示100
+	MaxLen int   //字符串的最大rune个数，<=0表示20
+}
+
+//随机生成一个Movie
+//字符串由可打印字符组成，一半是ASCII(包括<&>"等需要转义的字符)，一半是任意可打印的Unicode字符
+//控制字符不在范围内，XML无法表示它们
+func RandomMovie(r *rand.Rand, maxLen int) common.Movie {
+	return common.Movie{
+		Name:  randomString(r, maxLen),
+		Type:  randomString(r, maxLen),
+		Score: int(r.Uint64()),
+	}
+}
+
+func randomString(r *rand.Rand, maxLen int) string {
+	n := r.Intn(maxLen + 1)
+	runes := make([]rune, 0, n)
+	for len(runes) < n {
+		if r.Intn(2) == 0 {
+			runes = append(runes, rune(' '+r.Intn('~'-' '+1)))
+			continue
+		}
+		c := rune(r.Intn(utf8.MaxRune + 1))
+		if utf8.ValidRune(c) && unicode.IsPrint(c) {
+			runes = append(runes, c)
+		}
+	}
+	return string(runes)
+}
+
+//对c做cfg.Count次往返检查
+func RoundTrip(t *testing.T, c common.Codec, cfg Config) {
+	t.Helper()
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	if cfg.Count <= 0 {
+		cfg.Count = 100
+	}
+	if cfg.MaxLen <= 0 {
+		cfg.MaxLen = 20
+	}
+
+	var failure string
+	check := func(m common.Movie) bool {
+		data, err := c.Marshal(m)
+		if err != nil {
+			failure = fmt.Sprintf("Marshal(%+q) error = %v", m, err)
+			return false
+		}
+		var got common.Movie
+		if err := c.Unmarshal(data, &got); err != nil {
+			failure = fmt.Sprintf("Unmarshal(%q) error = %v, input %+q", data, err, m)
+			return false
+		}
+		if got != m {
+			failure = fmt.Sprintf("Unmarshal(Marshal(m)) = %+q, want %+q, data %q", got, m, data)
+			return false
+		}
+		return true
+	}
+	qc := &quick.Config{
+		MaxCount: cfg.Count,
+		Rand:     rand.New(rand.NewSource(cfg.Seed)),
+		Values: func(args []reflect.Value, r *rand.Rand) {
+			args[0] = reflect.ValueOf(RandomMovie(r, cfg.MaxLen))
+		},
+	}
+	if err := quick.Check(check, qc); err != nil {
+		t.Errorf("%T round trip failed (seed %d): %s", c, cfg.Seed, failure)
+	}
+}
@@ -0,0 +1,45 @@
+package codectest
+
+import (
+	"math/rand"
+	"testing"
+	"unicode"
+
+	"github.com/hq-cml/go-unittest/common"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []common.Format{common.FormatJSON, common.FormatXML, common.FormatGob, common.FormatCSV} {
+		format := format
+		t.Run(string(format), func(t *testing.T) {
+			c, err := common.NewCodec(common.WithFormat(format))
+			if err != nil {
+				t.Fatalf("NewCodec(%s) error = %v", format, err)
+			}
+			RoundTrip(t, c, Config{Count: 500})
+		})
+	}
+}
+
+func TestRandomMovie(t *testing.T) {
+	a := RandomMovie(rand.New(rand.NewSource(1)), 10)
+	b := RandomMovie(rand.New(rand.NewSource(1)), 10)
+	if a != b {
+		t.Errorf("same seed got %+q and %+q", a, b)
+	}
+
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 1000; i++ {
+		m := RandomMovie(r, 10)
+		for _, s := range []string{m.Name, m.Type} {
+			if n := len([]rune(s)); n > 10 {
+				t.Fatalf("%q has %d runes, want <= 10", s, n)
+			}
+			for _, c := range s {
+				if !unicode.IsPrint(c) {
+					t.Fatalf("%q contains non-printable rune %U", s, c)
+				}
+			}
+		}
+	}
+}
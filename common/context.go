@@ -0,0 +1,220 @@
+package common
+
+import (
+	"context"
+)
+
+//StorageClient的context版本，所有方法第一个参数为ctx
+//ctx被取消或者超时后，方法返回ctx.Err()
+type ContextStorageClient interface {
+	GetContext(ctx context.Context, k string) (string, bool, error)
+	SetContext(ctx context.Context, k, v string) error
+	DeleteContext(ctx context.Context, k string) error
+	ExistsContext(ctx context.Context, k string) (bool, error)
+	KeysContext(ctx context.Context) ([]string, error)
+	ScanContext(ctx context.Context, prefix, cursor string, limit int) (keys []string, next string, err error)
+}
+
+//把StorageClient适配成ContextStorageClient，c本身已经支持context时直接返回
+//底层调用本身无法中断，ctx结束后会立即返回ctx.Err()，底层调用在后台跑完后结果被丢弃
+func NewContextClient(c StorageClient) ContextStorageClient {
+	if cc, ok := c.(ContextStorageClient); ok {
+		return cc
+	}
+	return &contextAdapter{c: c}
+}
+
+//把ContextStorageClient适配成StorageClient，供还不支持ctx的老代码使用，统一使用context.Background()
+//c本身已经是StorageClient时直接返回
+func NewPlainClient(c ContextStorageClient) StorageClient {
+	if sc, ok := c.(StorageClient); ok {
+		return sc
+	}
+	return &plainAdapter{c: c}
+}
+
+type contextAdapter struct {
+	c StorageClient
+}
+
+//在ctx的控制下执行f
+func (a *contextAdapter) do(ctx context.Context, f func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		f()
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *contextAdapter) GetContext(ctx context.Context, k string) (string, bool, error) {
+	var v string
+	var ok bool
+	if err := a.do(ctx, func() { v, ok = a.c.Get(k) }); err != nil {
+		return "", false, err
+	}
+	return v, ok, nil
+}
+
+func (a *contextAdapter) SetContext(ctx context.Context, k, v string) error {
+	var err error
+	if e := a.do(ctx, func() { err = a.c.Set(k, v) }); e != nil {
+		return e
+	}
+	return err
+}
+
+func (a *contextAdapter) DeleteContext(ctx context.Context, k string) error {
+	var err error
+	if e := a.do(ctx, func() { err = a.c.Delete(k) }); e != nil {
+		return e
+	}
+	return err
+}
+
+func (a *contextAdapter) ExistsContext(ctx context.Context, k string) (bool, error) {
+	var ok bool
+	if err := a.do(ctx, func() { ok = a.c.Exists(k) }); err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+func (a *contextAdapter) KeysContext(ctx context.Context) ([]string, error) {
+	var keys []string
+	var err error
+	if e := a.do(ctx, func() { keys, err = a.c.Keys() }); e != nil {
+		return nil, e
+	}
+	return keys, err
+}
+
+func (a *contextAdapter) ScanContext(ctx context.Context, prefix, cursor string, limit int) ([]string, string, error) {
+	var keys []string
+	var next string
+	var err error
+	if e := a.do(ctx, func() { keys, next, err = a.c.Scan(prefix, cursor, limit) }); e != nil {
+		return nil, "", e
+	}
+	return keys, next, err
+}
+
+//AtomicStorageClient.GetOrSet的context版本
+//c实现了GetOrSetContext(例如RealClient)时直接调用，否则在后台执行GetOrSet，ctx结束后立即返回ctx.Err()
+func GetOrSetContext(ctx context.Context, c AtomicStorageClient, k, def string) (string, bool, error) {
+	if cc, ok := c.(interface {
+		GetOrSetContext(ctx context.Context, k, def string) (string, bool, error)
+	}); ok {
+		return cc.GetOrSetContext(ctx, k, def)
+	}
+	var v string
+	var loaded bool
+	var err error
+	a := &contextAdapter{c: c}
+	if e := a.do(ctx, func() { v, loaded, err = c.GetOrSet(k, def) }); e != nil {
+		return "", false, e
+	}
+	return v, loaded, err
+}
+
+type plainAdapter struct {
+	c ContextStorageClient
+}
+
+func (a *plainAdapter) Get(k string) (string, bool) {
+	v, ok, err := a.c.GetContext(context.Background(), k)
+	if err != nil {
+		return "", false
+	}
+	return v, ok
+}
+
+func (a *plainAdapter) Set(k, v string) error {
+	return a.c.SetContext(context.Background(), k, v)
+}
+
+func (a *plainAdapter) Delete(k string) error {
+	return a.c.DeleteContext(context.Background(), k)
+}
+
+func (a *plainAdapter) Exists(k string) bool {
+	ok, err := a.c.ExistsContext(context.Background(), k)
+	return err == nil && ok
+}
+
+func (a *plainAdapter) Keys() ([]string, error) {
+	return a.c.KeysContext(context.Background())
+}
+
+func (a *plainAdapter) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	return a.c.ScanContext(context.Background(), prefix, cursor, limit)
+}
+
+//RealClient的context版本，操作都在内存中完成，只需要在开始前检查ctx
+func (m *RealClient) GetContext(ctx context.Context, k string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	v, ok := m.Get(k)
+	return v, ok, nil
+}
+
+func (m *RealClient) SetContext(ctx context.Context, k, v string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Set(k, v)
+}
+
+func (m *RealClient) DeleteContext(ctx context.Context, k string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Delete(k)
+}
+
+func (m *RealClient) ExistsContext(ctx context.Context, k string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return m.Exists(k), nil
+}
+
+func (m *RealClient) GetOrSetContext(ctx context.Context, k, def string) (string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
+	return m.GetOrSet(k, def)
+}
+
+func (m *RealClient) KeysContext(ctx context.Context) ([]string, error) {
+	keys, _, err := m.ScanContext(ctx, "", "", 0)
+	return keys, err
+}
+
+//遍历所有key比较耗时，遍历前后各检查一次ctx
+func (m *RealClient) ScanContext(ctx context.Context, prefix, cursor string, limit int) ([]string, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	keys, next, err := m.Scan(prefix, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	return keys, next, nil
+}
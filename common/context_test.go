@@ -0,0 +1,111 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+//只实现了StorageClient的client，Get会阻塞到release被关闭
+type blockingClient struct {
+	StorageClient
+	release chan struct{}
+}
+
+func (c *blockingClient) Get(k string) (string, bool) {
+	<-c.release
+	return c.StorageClient.Get(k)
+}
+
+//GetOrSet会阻塞到release被关闭，不支持context
+type blockingAtomicClient struct {
+	AtomicStorageClient
+	release chan struct{}
+}
+
+func (c *blockingAtomicClient) GetOrSet(k, def string) (string, bool, error) {
+	<-c.release
+	return c.AtomicStorageClient.GetOrSet(k, def)
+}
+
+func TestGetOrSetContext(t *testing.T) {
+	convey.Convey("TestGetOrSetContext", t, func() {
+		convey.Convey("real client", func() {
+			client := NewRealClient()
+			v, loaded, err := GetOrSetContext(context.Background(), client, "k1", "v1")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(loaded, convey.ShouldBeFalse)
+			convey.So(v, convey.ShouldEqual, "v1")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, _, err = GetOrSetContext(ctx, client, "k2", "v2")
+			convey.So(errors.Is(err, context.Canceled), convey.ShouldBeTrue)
+			convey.So(client.Exists("k2"), convey.ShouldBeFalse)
+		})
+
+		convey.Convey("returns when deadline passes", func() {
+			inner := &blockingAtomicClient{AtomicStorageClient: NewRealClient(), release: make(chan struct{})}
+			defer close(inner.release)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, _, err := GetOrSetContext(ctx, inner, "k1", "v1")
+			convey.So(errors.Is(err, context.DeadlineExceeded), convey.ShouldBeTrue)
+		})
+	})
+}
+
+func TestContextClient(t *testing.T) {
+	convey.Convey("TestContextClient", t, func() {
+		convey.Convey("real client supports context itself", func() {
+			client := NewRealClient()
+			convey.So(NewContextClient(client), convey.ShouldEqual, client)
+			convey.So(NewPlainClient(client), convey.ShouldEqual, client)
+		})
+
+		convey.Convey("real client returns ctx.Err()", func() {
+			client := NewRealClient()
+			ctx, cancel := context.WithCancel(context.Background())
+			convey.So(client.SetContext(ctx, "k1", "v1"), convey.ShouldBeNil)
+			cancel()
+
+			_, _, err := client.GetContext(ctx, "k1")
+			convey.So(errors.Is(err, context.Canceled), convey.ShouldBeTrue)
+			convey.So(errors.Is(client.SetContext(ctx, "k1", "v2"), context.Canceled), convey.ShouldBeTrue)
+			_, err = client.KeysContext(ctx)
+			convey.So(errors.Is(err, context.Canceled), convey.ShouldBeTrue)
+			v, _ := client.Get("k1")
+			convey.So(v, convey.ShouldEqual, "v1")
+		})
+
+		convey.Convey("adapter returns when deadline passes", func() {
+			inner := &blockingClient{StorageClient: NewRealClient(), release: make(chan struct{})}
+			defer close(inner.release)
+			client := NewContextClient(inner)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, _, err := client.GetContext(ctx, "k1")
+			convey.So(errors.Is(err, context.DeadlineExceeded), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("adapter round trip", func() {
+			inner := &blockingClient{StorageClient: NewRealClient(), release: make(chan struct{})}
+			close(inner.release)
+			client := NewPlainClient(NewContextClient(inner))
+
+			convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+			v, ok := client.Get("k1")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(v, convey.ShouldEqual, "v1")
+			convey.So(client.Exists("k1"), convey.ShouldBeTrue)
+			convey.So(client.Delete("k1"), convey.ShouldBeNil)
+			keys, err := client.Keys()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,254 @@
+package common
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ * Movie和CSV之间的转换，第一行是表头，之后每行一部电影，例如：
+ *   name,type,score
+ *   Titanic,Love,95
+ * 解码时按表头找到各个字段所在的列，列的顺序随意，多余的列被忽略，表头不区分大小写
+ * 编码时按Name、Type、Score的顺序输出，行尾为\n
+ * 和encoding/csv一样，解码时引号内的\r\n会变成\n，因此含有\r\n的字段无法原样往返
+ */
+
+//引号策略，决定编码时哪些字段要加引号
+type QuotePolicy int
+
+const (
+	QuoteMinimal    QuotePolicy = iota //只有包含分隔符、引号、换行或者以空白开头的字段才加引号
+	QuoteAll                           //所有字段都加引号
+	QuoteNonNumeric                    //除了Score之外都加引号
+)
+
+//Movie各个字段在表头中的列名
+type CSVColumns struct {
+	Name  string
+	Type  string
+	Score string
+}
+
+//CSVCodec.Columns不设置(或者只有空白)时的列名
+var DefaultCSVColumns = CSVColumns{Name: "name", Type: "type", Score: "score"}
+
+//某一行的某一列无法解析，Row和Column都从1开始，表头是第1行
+type CSVError struct {
+	Row    int
+	Column int
+	Header string //列名
+	Err    error
+}
+
+func (e *CSVError) Error() string {
+	return fmt.Sprintf("csv: row %d, column %d (%s): %v", e.Row, e.Column, e.Header, e.Err)
+}
+
+func (e *CSVError) Unwrap() error {
+	return e.Err
+}
+
+//CSV格式的Codec，零值可以直接使用
+//Marshal支持Movie、[]Movie、[]*Movie以及它们的指针
+//Unmarshal支持*[]Movie、*[]*Movie，以及*Movie(要求正好一行数据)
+type CSVCodec struct {
+	Columns CSVColumns  //列名，会去掉首尾的空白，空的字段使用DefaultCSVColumns中的值
+	Comma   rune        //分隔符，默认为','
+	Quote   QuotePolicy //编码时的引号策略，默认为QuoteMinimal
+}
+
+func (c CSVCodec) columns() CSVColumns {
+	cols := CSVColumns{
+		Name:  strings.TrimSpace(c.Columns.Name),
+		Type:  strings.TrimSpace(c.Columns.Type),
+		Score: strings.TrimSpace(c.Columns.Score),
+	}
+	if cols.Name == "" {
+		cols.Name = DefaultCSVColumns.Name
+	}
+	if cols.Type == "" {
+		cols.Type = DefaultCSVColumns.Type
+	}
+	if cols.Score == "" {
+		cols.Score = DefaultCSVColumns.Score
+	}
+	return cols
+}
+
+func (c CSVCodec) comma() rune {
+	if c.Comma == 0 {
+		return ','
+	}
+	return c.Comma
+}
+
+func (c CSVCodec) Marshal(v interface{}) ([]byte, error) {
+	var movies []Movie
+	switch x := v.(type) {
+	case Movie:
+		movies = []Movie{x}
+	case *Movie:
+		movies = []Movie{*x}
+	case []Movie:
+		movies = x
+	case *[]Movie:
+		movies = *x
+	case []*Movie:
+		return c.Marshal(&x)
+	case *[]*Movie:
+		for i, m := range *x {
+			if m == nil {
+				return nil, fmt.Errorf("csv: nil *Movie at index %d", i)
+			}
+			movies = append(movies, *m)
+		}
+	default:
+		return nil, fmt.Errorf("csv: unsupported type %T", v)
+	}
+	comma := c.comma()
+	if !validCSVDelim(comma) {
+		return nil, fmt.Errorf("csv: invalid delimiter %q", comma)
+	}
+
+	var buf bytes.Buffer
+	cols := c.columns()
+	c.writeRecord(&buf, comma, [3]string{cols.Name, cols.Type, cols.Score}, false)
+	for _, m := range movies {
+		c.writeRecord(&buf, comma, [3]string{m.Name, m.Type, strconv.Itoa(m.Score)}, true)
+	}
+	return buf.Bytes(), nil
+}
+
+func (c CSVCodec) Unmarshal(data []byte, v interface{}) error {
+	switch x := v.(type) {
+	case *[]Movie:
+		movies, err := c.read(data)
+		if err != nil {
+			return err
+		}
+		*x = movies
+	case *[]*Movie:
+		movies, err := c.read(data)
+		if err != nil {
+			return err
+		}
+		ptrs := make([]*Movie, len(movies))
+		for i := range movies {
+			ptrs[i] = &movies[i]
+		}
+		*x = ptrs
+	case *Movie:
+		movies, err := c.read(data)
+		if err != nil {
+			return err
+		}
+		if len(movies) != 1 {
+			return fmt.Errorf("csv: decoding into *Movie needs exactly 1 row, got %d", len(movies))
+		}
+		*x = movies[0]
+	default:
+		return fmt.Errorf("csv: unsupported type %T", v)
+	}
+	return nil
+}
+
+func (c CSVCodec) read(data []byte) ([]Movie, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = c.comma()
+	r.ReuseRecord = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, errors.New("csv: missing header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	cols := c.columns()
+	idx := map[string]int{}
+	for i, h := range header {
+		if i == 0 {
+			h = strings.TrimPrefix(h, "\ufeff") //Excel导出的文件可能带有BOM
+		}
+		h = strings.ToLower(strings.TrimSpace(h))
+		if _, ok := idx[h]; !ok {
+			idx[h] = i
+		}
+	}
+	var pos [3]int
+	for i, name := range []string{cols.Name, cols.Type, cols.Score} {
+		p, ok := idx[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("csv: missing column %q in header", name)
+		}
+		pos[i] = p
+	}
+
+	movies := []Movie{}
+	for row := 2; ; row++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			return movies, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		score, err := strconv.Atoi(strings.TrimSpace(record[pos[2]]))
+		if err != nil {
+			if ne, ok := err.(*strconv.NumError); ok {
+				err = fmt.Errorf("invalid integer %q: %v", ne.Num, ne.Err)
+			}
+			return nil, &CSVError{Row: row, Column: pos[2] + 1, Header: cols.Score, Err: err}
+		}
+		movies = append(movies, Movie{Name: record[pos[0]], Type: record[pos[1]], Score: score})
+	}
+}
+
+//按c.Quote决定是否加引号，data为false表示表头，表头的三列都按非数字处理
+func (c CSVCodec) writeRecord(buf *bytes.Buffer, comma rune, fields [3]string, data bool) {
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteRune(comma)
+		}
+		quote := csvNeedsQuotes(f, comma)
+		switch c.Quote {
+		case QuoteAll:
+			quote = true
+		case QuoteNonNumeric:
+			quote = quote || !data || i != 2
+		}
+		if !quote {
+			buf.WriteString(f)
+			continue
+		}
+		buf.WriteByte('"')
+		buf.WriteString(strings.Replace(f, `"`, `""`, -1))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('\n')
+}
+
+//和encoding/csv.Writer的判断一致
+func csvNeedsQuotes(f string, comma rune) bool {
+	if f == "" {
+		return false
+	}
+	if f == `\.` || strings.ContainsRune(f, comma) || strings.ContainsAny(f, "\"\r\n") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(f)
+	return unicode.IsSpace(r)
+}
+
+//和encoding/csv.Reader的要求一致
+func validCSVDelim(r rune) bool {
+	return r != 0 && r != '"' && r != '\r' && r != '\n' && utf8.ValidRune(r) && r != utf8.RuneError
+}
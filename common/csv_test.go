@@ -0,0 +1,151 @@
+package common
+
+import (
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+var csvMovies = []Movie{
+	{Name: "Titanic", Type: "Love", Score: 95},
+	{Name: "Crouching Tiger, Hidden Dragon", Type: "Action", Score: 90},
+	{Name: `The "Room"`, Type: "Drama", Score: 3},
+	{Name: " leading space", Type: "", Score: 0},
+}
+
+func TestCSVCodecMarshal(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec CSVCodec
+		input interface{}
+		want  string
+	}{
+		{"minimal", CSVCodec{}, csvMovies, "name,type,score\n" +
+			"Titanic,Love,95\n" +
+			"\"Crouching Tiger, Hidden Dragon\",Action,90\n" +
+			"\"The \"\"Room\"\"\",Drama,3\n" +
+			"\" leading space\",,0\n"},
+		{"quote all", CSVCodec{Quote: QuoteAll}, csvMovies[:1], "\"name\",\"type\",\"score\"\n\"Titanic\",\"Love\",\"95\"\n"},
+		{"quote non-numeric", CSVCodec{Quote: QuoteNonNumeric}, &csvMovies[0], "\"name\",\"type\",\"score\"\n\"Titanic\",\"Love\",95\n"},
+		{"columns and comma", CSVCodec{Columns: CSVColumns{Name: "Title", Score: "Rating"}, Comma: ';'},
+			[]*Movie{&csvMovies[1]}, "Title;type;Rating\nCrouching Tiger, Hidden Dragon;Action;90\n"},
+		{"empty", CSVCodec{}, []Movie{}, "name,type,score\n"},
+		{"columns are trimmed", CSVCodec{Columns: CSVColumns{Name: " Title ", Type: "\t"}}, csvMovies[:1],
+			"Title,type,score\nTitanic,Love,95\n"},
+	}
+	for _, tt := range tests {
+		got, err := tt.codec.Marshal(tt.input)
+		if err != nil {
+			t.Errorf("%s: Marshal() error = %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: Marshal() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+//编码的结果用encoding/csv可以原样读回来
+func TestCSVCodecCompatible(t *testing.T) {
+	for _, q := range []QuotePolicy{QuoteMinimal, QuoteAll, QuoteNonNumeric} {
+		data, _ := CSVCodec{Quote: q}.Marshal(csvMovies)
+		records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+		if err != nil {
+			t.Fatalf("quote %d: ReadAll() error = %v", q, err)
+		}
+		if len(records) != len(csvMovies)+1 {
+			t.Fatalf("quote %d: got %d records", q, len(records))
+		}
+		for i, m := range csvMovies {
+			if records[i+1][0] != m.Name || records[i+1][1] != m.Type {
+				t.Errorf("quote %d: record %d = %q, want %+v", q, i+1, records[i+1], m)
+			}
+		}
+	}
+}
+
+func TestCSVCodecUnmarshal(t *testing.T) {
+	convey.Convey("TestCSVCodecUnmarshal", t, func() {
+		convey.Convey("round trip", func() {
+			for _, q := range []QuotePolicy{QuoteMinimal, QuoteAll, QuoteNonNumeric} {
+				c := CSVCodec{Quote: q, Comma: '\t'}
+				data, err := c.Marshal(csvMovies)
+				convey.So(err, convey.ShouldBeNil)
+				var got []Movie
+				convey.So(c.Unmarshal(data, &got), convey.ShouldBeNil)
+				convey.So(got, convey.ShouldResemble, csvMovies)
+			}
+		})
+
+		convey.Convey("header mapping", func() {
+			data := "\ufeffRating, Genre ,Title,Year\n95,Love,Titanic,1997\n"
+			c := CSVCodec{Columns: CSVColumns{Name: "title", Type: "genre", Score: "rating"}}
+			var got []*Movie
+			convey.So(c.Unmarshal([]byte(data), &got), convey.ShouldBeNil)
+			convey.So(got, convey.ShouldResemble, []*Movie{{Name: "Titanic", Type: "Love", Score: 95}})
+
+			err := CSVCodec{}.Unmarshal([]byte(data), &got)
+			convey.So(err.Error(), convey.ShouldEqual, `csv: missing column "name" in header`)
+
+			//列名前后的空白被忽略
+			c = CSVCodec{Columns: CSVColumns{Name: " title ", Type: "genre\t", Score: " rating"}}
+			convey.So(c.Unmarshal([]byte(data), &got), convey.ShouldBeNil)
+			convey.So(got, convey.ShouldResemble, []*Movie{{Name: "Titanic", Type: "Love", Score: 95}})
+		})
+
+		convey.Convey("crlf inside quotes becomes lf", func() {
+			m := Movie{Name: "line1\r\nline2", Type: "Drama", Score: 1}
+			data, err := CSVCodec{}.Marshal(m)
+			convey.So(err, convey.ShouldBeNil)
+			var got Movie
+			convey.So(CSVCodec{}.Unmarshal(data, &got), convey.ShouldBeNil)
+			convey.So(got.Name, convey.ShouldEqual, "line1\nline2")
+		})
+
+		convey.Convey("single movie", func() {
+			var m Movie
+			convey.So(CSVCodec{}.Unmarshal([]byte("name,type,score\nTitanic,Love, 95\n"), &m), convey.ShouldBeNil)
+			convey.So(m, convey.ShouldResemble, csvMovies[0])
+			convey.So(CSVCodec{}.Unmarshal([]byte("name,type,score\n"), &m), convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("bad score names row and column", func() {
+			data := "type,name,score\nLove,Titanic,95\nAction,Hero,nine\n"
+			var got []Movie
+			err := CSVCodec{}.Unmarshal([]byte(data), &got)
+			var cerr *CSVError
+			convey.So(errors.As(err, &cerr), convey.ShouldBeTrue)
+			convey.So(cerr.Row, convey.ShouldEqual, 3)
+			convey.So(cerr.Column, convey.ShouldEqual, 3)
+			convey.So(err.Error(), convey.ShouldEqual, `csv: row 3, column 3 (score): invalid integer "nine": invalid syntax`)
+			convey.So(got, convey.ShouldBeNil)
+		})
+
+		convey.Convey("malformed input", func() {
+			var got []Movie
+			convey.So(CSVCodec{}.Unmarshal(nil, &got).Error(), convey.ShouldEqual, "csv: missing header")
+			err := CSVCodec{}.Unmarshal([]byte("name,type,score\nTitanic,Love\n"), &got)
+			var perr *csv.ParseError
+			convey.So(errors.As(err, &perr), convey.ShouldBeTrue)
+			convey.So(CSVCodec{}.Unmarshal([]byte("name,type,score\n"), new(string)), convey.ShouldNotBeNil)
+			_, err = CSVCodec{}.Marshal("Titanic")
+			convey.So(err, convey.ShouldNotBeNil)
+			_, err = CSVCodec{Comma: '"'}.Marshal(csvMovies)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("through the Decoder interface", func() {
+			dec, err := NewDecoderWithOptions(WithContentType("text/csv"), WithValidation())
+			convey.So(err, convey.ShouldBeNil)
+			var got []Movie
+			convey.So(dec.Unmarshal([]byte("name,type,score\nTitanic,Love,95\n"), &got), convey.ShouldBeNil)
+			err = dec.Unmarshal([]byte("name,type,score\nTitanic,Love,95\nHero,Wuxia,90\n"), &got)
+			var verr *ValidationError
+			convey.So(errors.As(err, &verr), convey.ShouldBeTrue)
+			convey.So(verr.Errors[0].Field, convey.ShouldEqual, "[1].Type")
+		})
+	})
+}
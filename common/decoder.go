@@ -4,13 +4,27 @@ type Decoder interface {
 	Unmarshal([]byte, interface{}) error
 }
 
+//默认使用JSON
 func NewDecoder() Decoder {
-	var d Decoder
-	return d
+	return JSONCodec{}
 }
 
+//校验规则见Validate
 type Movie struct {
-	Name string
-	Type string
-	Score int
-}
\ No newline at end of file
+	Name  string `validate:"required"`
+	Type  string `validate:"required,oneof=Action Animation Comedy Documentary Drama Horror Love SciFi"`
+	Score int    `validate:"min=0,max=100"`
+}
+
+//Decoder并入Codec之前的名字，保留下来兼容已有的代码
+type (
+	JSONDecoder   = JSONCodec
+	XMLDecoder    = XMLCodec
+	GobDecoder    = GobCodec
+	DecoderOption = CodecOption
+)
+
+//按配置选择Decoder，配置项和NewCodec相同，格式不支持时返回ErrUnsupportedFormat
+func NewDecoderWithOptions(opts ...DecoderOption) (Decoder, error) {
+	return NewCodec(opts...)
+}
@@ -0,0 +1,137 @@
+package common
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestFormatForContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        Format
+		wantErr     bool
+	}{
+		{"application/json", FormatJSON, false},
+		{"application/json; charset=utf-8", FormatJSON, false},
+		{"Application/JSON", FormatJSON, false},
+		{"application/problem+json", FormatJSON, false},
+		{"text/xml; charset=utf-8", FormatXML, false},
+		{"application/atom+xml", FormatXML, false},
+		{"application/x-gob", FormatGob, false},
+		{"text/csv; header=present", FormatCSV, false},
+		{"text/plain", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := FormatForContentType(tt.contentType)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("FormatForContentType(%q) error = %v, wantErr %v", tt.contentType, err, tt.wantErr)
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("FormatForContentType(%q) error = %v, want ErrUnsupportedFormat", tt.contentType, err)
+		}
+		if got != tt.want {
+			t.Errorf("FormatForContentType(%q) = %q, want %q", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+//用标准库编码，再用对应的Decoder解码回来
+func TestDecoderRoundTrip(t *testing.T) {
+	movies := []Movie{
+		{Name: "Titanic", Type: "Love", Score: 9},
+		{Name: "霸王别姬", Type: "剧情", Score: 10},
+		{Name: "<&>\"'", Type: "", Score: -1},
+		{},
+	}
+	encoders := []struct {
+		format Format
+		encode func(interface{}) ([]byte, error)
+	}{
+		{FormatJSON, json.Marshal},
+		{FormatXML, xml.Marshal},
+		{FormatGob, func(v interface{}) ([]byte, error) {
+			var buf bytes.Buffer
+			err := gob.NewEncoder(&buf).Encode(v)
+			return buf.Bytes(), err
+		}},
+	}
+	for _, enc := range encoders {
+		dec, err := NewDecoderWithOptions(WithFormat(enc.format))
+		if err != nil {
+			t.Fatalf("NewDecoderWithOptions(%s) error = %v", enc.format, err)
+		}
+		for _, m := range movies {
+			data, err := enc.encode(&m)
+			if err != nil {
+				t.Fatalf("%s encode %+v error = %v", enc.format, m, err)
+			}
+			var got Movie
+			if err := dec.Unmarshal(data, &got); err != nil {
+				t.Errorf("%s Unmarshal(%q) error = %v", enc.format, data, err)
+				continue
+			}
+			if got != m {
+				t.Errorf("%s round trip = %+v, want %+v", enc.format, got, m)
+			}
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	convey.Convey("TestDecoder", t, func() {
+		convey.Convey("NewDecoder is json", func() {
+			var m Movie
+			err := NewDecoder().Unmarshal([]byte(`{"Name":"Titanic","Type":"Love","Score":9}`), &m)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(m, convey.ShouldResemble, Movie{Name: "Titanic", Type: "Love", Score: 9})
+		})
+
+		convey.Convey("choose by content type", func() {
+			dec, err := NewDecoderWithOptions(WithContentType("application/xml"))
+			convey.So(err, convey.ShouldBeNil)
+			var m Movie
+			err = dec.Unmarshal([]byte(`<Movie><Name>Titanic</Name><Score>9</Score></Movie>`), &m)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(m, convey.ShouldResemble, Movie{Name: "Titanic", Score: 9})
+
+			_, err = NewDecoderWithOptions(WithContentType("text/plain"))
+			convey.So(errors.Is(err, ErrUnsupportedFormat), convey.ShouldBeTrue)
+			_, err = NewDecoderWithOptions(WithFormat("yaml"))
+			convey.So(errors.Is(err, ErrUnsupportedFormat), convey.ShouldBeTrue)
+
+			//后设置的覆盖先设置的
+			dec, err = NewDecoderWithOptions(WithContentType("text/plain"), WithFormat(FormatGob))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(dec, convey.ShouldHaveSameTypeAs, GobDecoder{})
+		})
+
+		convey.Convey("unknown fields", func() {
+			data := []byte(`{"Name":"Titanic","Year":1997}`)
+			var m Movie
+			convey.So(NewDecoder().Unmarshal(data, &m), convey.ShouldBeNil)
+			convey.So(m.Name, convey.ShouldEqual, "Titanic")
+
+			dec, _ := NewDecoderWithOptions(WithDisallowUnknownFields())
+			convey.So(dec.Unmarshal(data, &m), convey.ShouldNotBeNil)
+			convey.So(dec.Unmarshal([]byte(`{"Name":"a"} {}`), &m), convey.ShouldNotBeNil)
+			convey.So(dec.Unmarshal([]byte(`{"Name":"a"} `), &m), convey.ShouldBeNil)
+		})
+
+		convey.Convey("malformed input", func() {
+			var m Movie
+			for _, format := range []Format{FormatJSON, FormatXML, FormatGob} {
+				dec, _ := NewDecoderWithOptions(WithFormat(format))
+				convey.So(dec.Unmarshal([]byte("not a movie"), &m), convey.ShouldNotBeNil)
+				convey.So(dec.Unmarshal(nil, &m), convey.ShouldNotBeNil)
+			}
+		})
+	})
+}
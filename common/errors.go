@@ -0,0 +1,62 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+)
+
+//错误分类，调用方通过errors.Is判断类别，需要细节时用errors.As取出具体的错误类型
+var (
+	//key不存在，具体错误为*NotFoundError
+	ErrNotFound = errors.New("storage: not found")
+	//读到的值和期望的不一致，具体错误为*ValueMismatchError
+	ErrValueMismatch = errors.New("storage: value mismatch")
+	//后端不可用，例如连接失败、已经关闭、熔断，具体错误一般为*UnavailableError
+	ErrBackendUnavailable = errors.New("storage: backend unavailable")
+)
+
+//key不存在
+type NotFoundError struct {
+	Key string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("storage: key %q not found", e.Key)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+//key的值和期望的不一致
+type ValueMismatchError struct {
+	Key      string
+	Expected string
+	Actual   string
+}
+
+func (e *ValueMismatchError) Error() string {
+	return fmt.Sprintf("storage: key %q value mismatch: expected %q, actual %q", e.Key, e.Expected, e.Actual)
+}
+
+func (e *ValueMismatchError) Is(target error) bool {
+	return target == ErrValueMismatch
+}
+
+//后端不可用，Err为底层的原因
+type UnavailableError struct {
+	Backend string //后端的描述，例如"resp 127.0.0.1:6379"
+	Err     error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("storage: %s unavailable: %v", e.Backend, e.Err)
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrBackendUnavailable
+}
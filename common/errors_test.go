@@ -0,0 +1,81 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestErrors(t *testing.T) {
+	convey.Convey("TestErrors", t, func() {
+		tests := []struct {
+			name    string
+			err     error
+			is      []error
+			isNot   []error
+			message string
+		}{
+			{
+				name:    "not found",
+				err:     &NotFoundError{Key: "k1"},
+				is:      []error{ErrNotFound},
+				isNot:   []error{ErrValueMismatch, ErrBackendUnavailable},
+				message: `storage: key "k1" not found`,
+			},
+			{
+				name:    "value mismatch",
+				err:     &ValueMismatchError{Key: "k1", Expected: "a", Actual: "b"},
+				is:      []error{ErrValueMismatch},
+				isNot:   []error{ErrNotFound, ErrBackendUnavailable},
+				message: `storage: key "k1" value mismatch: expected "a", actual "b"`,
+			},
+			{
+				name:    "unavailable",
+				err:     &UnavailableError{Backend: "resp 127.0.0.1:6379", Err: io.EOF},
+				is:      []error{ErrBackendUnavailable, io.EOF},
+				isNot:   []error{ErrNotFound, ErrValueMismatch},
+				message: "storage: resp 127.0.0.1:6379 unavailable: EOF",
+			},
+			{
+				name:  "wrapped",
+				err:   fmt.Errorf("replace: %w", &ValueMismatchError{Key: "k1"}),
+				is:    []error{ErrValueMismatch},
+				isNot: []error{ErrNotFound},
+			},
+			{
+				name:    "circuit open",
+				err:     ErrCircuitOpen,
+				is:      []error{ErrBackendUnavailable},
+				isNot:   []error{ErrNotFound},
+				message: "storage: circuit breaker is open",
+			},
+		}
+		for _, tt := range tests {
+			convey.Convey(tt.name, func() {
+				for _, target := range tt.is {
+					convey.So(errors.Is(tt.err, target), convey.ShouldBeTrue)
+				}
+				for _, target := range tt.isNot {
+					convey.So(errors.Is(tt.err, target), convey.ShouldBeFalse)
+				}
+				if tt.message != "" {
+					convey.So(tt.err.Error(), convey.ShouldEqual, tt.message)
+				}
+			})
+		}
+
+		convey.Convey("As", func() {
+			err := fmt.Errorf("check: %w", &ValueMismatchError{Key: "k1", Expected: "a", Actual: "b"})
+			var me *ValueMismatchError
+			convey.So(errors.As(err, &me), convey.ShouldBeTrue)
+			convey.So(me.Expected, convey.ShouldEqual, "a")
+			convey.So(me.Actual, convey.ShouldEqual, "b")
+
+			var nf *NotFoundError
+			convey.So(errors.As(err, &nf), convey.ShouldBeFalse)
+		})
+	})
+}
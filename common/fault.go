@@ -0,0 +1,204 @@
+package common
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+//注入的默认错误
+var ErrInjected = errors.New("storage: injected fault")
+
+//一条故障规则
+//Key非空时只匹配这个key，否则匹配所有以Prefix开头的key(Prefix为空则匹配全部)
+//Keys没有key参数，按""匹配；Scan按它的prefix参数匹配
+type FaultRule struct {
+	Key    string
+	Prefix string
+
+	ErrorRate     float64       //返回错误的概率，Get/Exists没有error，按未命中处理
+	Latency       time.Duration //每次调用额外增加的延迟
+	DropWriteRate float64       //写操作(Set/Delete)返回nil但什么都不做的概率
+	StaleReadRate float64       //Get返回这个key上一次写入之前的旧值的概率
+}
+
+func (r *FaultRule) match(key string) bool {
+	if r.Key != "" {
+		return r.Key == key
+	}
+	return strings.HasPrefix(key, r.Prefix)
+}
+
+//FaultClient的配置
+type FaultConfig struct {
+	Seed  int64               //随机种子，相同的种子、相同的调用顺序得到相同的故障序列
+	Rules []FaultRule         //按顺序匹配，第一条命中的规则生效，都不命中则不注入故障
+	Err   error               //注入的错误，默认ErrInjected
+	Sleep func(time.Duration) //注入延迟用，默认time.Sleep，单测中可以换成FakeClock.Sleep
+}
+
+//已经注入的故障次数
+type FaultStats struct {
+	Errors  uint64
+	Drops   uint64
+	Stale   uint64
+	Delayed uint64
+}
+
+//按配置给任意StorageClient注入故障，用于混沌测试和覆盖调用方的错误分支
+type FaultClient struct {
+	c   StorageClient
+	cfg FaultConfig
+
+	mu    sync.Mutex
+	rand  *rand.Rand
+	stale map[string]staleValue //每个key上一次写入之前的值，只记录配置了StaleReadRate的key
+	stats FaultStats
+}
+
+type staleValue struct {
+	v  string
+	ok bool
+}
+
+func NewFaultClient(c StorageClient, cfg FaultConfig) *FaultClient {
+	if cfg.Err == nil {
+		cfg.Err = ErrInjected
+	}
+	if cfg.Sleep == nil {
+		cfg.Sleep = time.Sleep
+	}
+	return &FaultClient{
+		c:     c,
+		cfg:   cfg,
+		rand:  rand.New(rand.NewSource(cfg.Seed)),
+		stale: map[string]staleValue{},
+	}
+}
+
+func (f *FaultClient) Get(k string) (string, bool) {
+	rule := f.before(k)
+	if rule == nil {
+		return f.c.Get(k)
+	}
+	if f.roll(rule.ErrorRate, &f.stats.Errors) {
+		return "", false
+	}
+	if rule.StaleReadRate > 0 {
+		f.mu.Lock()
+		old, ok := f.stale[k]
+		f.mu.Unlock()
+		if ok && f.roll(rule.StaleReadRate, &f.stats.Stale) {
+			return old.v, old.ok
+		}
+	}
+	return f.c.Get(k)
+}
+
+func (f *FaultClient) Set(k, v string) error {
+	rule := f.before(k)
+	if rule == nil {
+		return f.c.Set(k, v)
+	}
+	if f.roll(rule.ErrorRate, &f.stats.Errors) {
+		return f.cfg.Err
+	}
+	if f.roll(rule.DropWriteRate, &f.stats.Drops) {
+		return nil
+	}
+	if rule.StaleReadRate > 0 {
+		f.remember(k)
+	}
+	return f.c.Set(k, v)
+}
+
+func (f *FaultClient) Delete(k string) error {
+	rule := f.before(k)
+	if rule == nil {
+		return f.c.Delete(k)
+	}
+	if f.roll(rule.ErrorRate, &f.stats.Errors) {
+		return f.cfg.Err
+	}
+	if f.roll(rule.DropWriteRate, &f.stats.Drops) {
+		return nil
+	}
+	if rule.StaleReadRate > 0 {
+		f.remember(k)
+	}
+	return f.c.Delete(k)
+}
+
+func (f *FaultClient) Exists(k string) bool {
+	rule := f.before(k)
+	if rule != nil && f.roll(rule.ErrorRate, &f.stats.Errors) {
+		return false
+	}
+	return f.c.Exists(k)
+}
+
+func (f *FaultClient) Keys() ([]string, error) {
+	rule := f.before("")
+	if rule != nil && f.roll(rule.ErrorRate, &f.stats.Errors) {
+		return nil, f.cfg.Err
+	}
+	return f.c.Keys()
+}
+
+func (f *FaultClient) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	rule := f.before(prefix)
+	if rule != nil && f.roll(rule.ErrorRate, &f.stats.Errors) {
+		return nil, "", f.cfg.Err
+	}
+	return f.c.Scan(prefix, cursor, limit)
+}
+
+//已经注入的故障次数
+func (f *FaultClient) Stats() FaultStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stats
+}
+
+//找到key匹配的规则，并注入延迟
+func (f *FaultClient) before(key string) *FaultRule {
+	for i := range f.cfg.Rules {
+		rule := &f.cfg.Rules[i]
+		if !rule.match(key) {
+			continue
+		}
+		if rule.Latency > 0 {
+			f.mu.Lock()
+			f.stats.Delayed++
+			f.mu.Unlock()
+			f.cfg.Sleep(rule.Latency)
+		}
+		return rule
+	}
+	return nil
+}
+
+//按概率决定是否注入，注入时累加对应的计数
+//概率<=0时不消耗随机数，这样增减其他规则不会打乱已有规则的故障序列
+func (f *FaultClient) roll(rate float64, counter *uint64) bool {
+	if rate <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rate < 1 && f.rand.Float64() >= rate {
+		return false
+	}
+	*counter++
+	return true
+}
+
+//写入之前记下旧值，供陈旧读使用
+func (f *FaultClient) remember(k string) {
+	v, ok := f.c.Get(k)
+	f.mu.Lock()
+	f.stale[k] = staleValue{v: v, ok: ok}
+	f.mu.Unlock()
+}
@@ -0,0 +1,139 @@
+package common
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+//按同样的顺序调用n次Set，返回每次是否出错
+func faultSequence(seed int64, n int) []bool {
+	client := NewFaultClient(NewRealClient(), FaultConfig{
+		Seed:  seed,
+		Rules: []FaultRule{{ErrorRate: 0.3}},
+	})
+	seq := make([]bool, n)
+	for i := range seq {
+		seq[i] = client.Set("k"+strconv.Itoa(i), "v") != nil
+	}
+	return seq
+}
+
+func TestFaultClient(t *testing.T) {
+	convey.Convey("TestFaultClient", t, func() {
+		clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		inner := NewRealClient()
+		boom := errors.New("boom")
+		client := NewFaultClient(inner, FaultConfig{
+			Seed: 1,
+			Rules: []FaultRule{
+				{Key: "user:vip", Latency: time.Second},
+				{Prefix: "user:", ErrorRate: 1},
+				{Prefix: "drop:", DropWriteRate: 1},
+				{Prefix: "stale:", StaleReadRate: 1},
+			},
+			Err:   boom,
+			Sleep: clock.Sleep,
+		})
+
+		convey.Convey("no rule matched", func() {
+			convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+			v, ok := client.Get("k1")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(v, convey.ShouldEqual, "v1")
+			convey.So(client.Stats(), convey.ShouldResemble, FaultStats{})
+		})
+
+		convey.Convey("error", func() {
+			inner.Set("user:1", "v1")
+			convey.So(client.Set("user:1", "v2"), convey.ShouldEqual, boom)
+			convey.So(client.Delete("user:1"), convey.ShouldEqual, boom)
+			_, ok := client.Get("user:1")
+			convey.So(ok, convey.ShouldBeFalse)
+			convey.So(client.Exists("user:1"), convey.ShouldBeFalse)
+			_, _, err := client.Scan("user:", "", 10)
+			convey.So(err, convey.ShouldEqual, boom)
+			//后端没有被改动
+			v, _ := inner.Get("user:1")
+			convey.So(v, convey.ShouldEqual, "v1")
+			convey.So(client.Stats().Errors, convey.ShouldEqual, 5)
+		})
+
+		convey.Convey("exact key rule takes precedence", func() {
+			convey.So(client.Set("user:vip", "v1"), convey.ShouldBeNil)
+			v, _ := client.Get("user:vip")
+			convey.So(v, convey.ShouldEqual, "v1")
+			convey.So(clock.Now().Sub(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)), convey.ShouldEqual, 2*time.Second)
+			convey.So(client.Stats().Delayed, convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("dropped write", func() {
+			convey.So(client.Set("drop:1", "v1"), convey.ShouldBeNil)
+			convey.So(inner.Exists("drop:1"), convey.ShouldBeFalse)
+			inner.Set("drop:2", "v2")
+			convey.So(client.Delete("drop:2"), convey.ShouldBeNil)
+			convey.So(inner.Exists("drop:2"), convey.ShouldBeTrue)
+			convey.So(client.Stats().Drops, convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("stale read", func() {
+			//没有写过的key读到的是真实值
+			inner.Set("stale:1", "v1")
+			v, _ := client.Get("stale:1")
+			convey.So(v, convey.ShouldEqual, "v1")
+
+			client.Set("stale:1", "v2")
+			v, _ = client.Get("stale:1")
+			convey.So(v, convey.ShouldEqual, "v1")
+
+			client.Delete("stale:1")
+			v, ok := client.Get("stale:1")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(v, convey.ShouldEqual, "v2")
+			convey.So(inner.Exists("stale:1"), convey.ShouldBeFalse)
+			convey.So(client.Stats().Stale, convey.ShouldEqual, 2)
+		})
+
+		convey.Convey("default error", func() {
+			client := NewFaultClient(inner, FaultConfig{Rules: []FaultRule{{ErrorRate: 1}}})
+			_, err := client.Keys()
+			convey.So(err, convey.ShouldEqual, ErrInjected)
+		})
+	})
+}
+
+func TestFaultClientSeed(t *testing.T) {
+	convey.Convey("TestFaultClientSeed", t, func() {
+		tests := []struct {
+			name string
+			a, b int64
+			same bool
+		}{
+			{name: "same seed", a: 1, b: 1, same: true},
+			{name: "different seed", a: 1, b: 2, same: false},
+		}
+		for _, tt := range tests {
+			convey.Convey(tt.name, func() {
+				a, b := faultSequence(tt.a, 200), faultSequence(tt.b, 200)
+				if tt.same {
+					convey.So(a, convey.ShouldResemble, b)
+				} else {
+					convey.So(a, convey.ShouldNotResemble, b)
+				}
+			})
+		}
+
+		convey.Convey("rate", func() {
+			n := 0
+			for _, failed := range faultSequence(3, 1000) {
+				if failed {
+					n++
+				}
+			}
+			convey.So(n, convey.ShouldBeBetween, 200, 400)
+		})
+	})
+}
@@ -0,0 +1,383 @@
+package common
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+ * 基于文件的持久化存储，进程重启后数据不丢失
+ *   每次Set/Delete都在日志文件末尾追加一条记录，打开时重放日志恢复数据
+ *   数据全部常驻内存，读操作不访问文件
+ *   日志中的无效记录越来越多时，后台把内存中的数据重写成一份新日志（compaction）
+ *
+ * 记录格式：
+ *   | crc32(4) | 长度(4) | 操作(1) | key长度(uvarint) | key | value |
+ *   crc32和长度都针对"操作"及之后的部分
+ *   进程在写一半时崩溃会留下不完整的记录，重放时遇到不完整或者校验失败的记录就停止，并把文件截断到最后一条完整记录
+ */
+
+const (
+	opSet byte = iota + 1
+	opDelete
+)
+
+const recordHeaderSize = 8
+
+//打开日志文件，单测中可以替换成返回错误的实现
+var openLogFile = os.OpenFile
+
+//追加记录和写失败后截断日志，单测中可以替换成只写一部分或者返回错误的实现
+var (
+	writeLog    = (*os.File).Write
+	truncateLog = (*os.File).Truncate
+)
+
+type FileClient struct {
+	mu      sync.Mutex //保护日志文件，读操作只访问mem
+	path    string
+	f       *os.File
+	size    int64 //日志文件大小
+	records int   //日志中的记录条数
+	mem     *RealClient
+	closed  bool
+	broken  error //compaction替换文件后重新打开失败，或者写失败后无法截断，之后的写入都返回*UnavailableError
+
+	compactInterval time.Duration
+	compactMinSize  int64
+	stop            chan struct{}
+	done            chan struct{}
+}
+
+//FileClient的可选配置
+type FileOption func(*FileClient)
+
+//后台检查是否需要compaction的间隔，d<=0表示不开启后台compaction
+func WithCompactInterval(d time.Duration) FileOption {
+	return func(c *FileClient) {
+		c.compactInterval = d
+	}
+}
+
+//日志文件小于n字节时不做compaction
+func WithCompactMinSize(n int64) FileOption {
+	return func(c *FileClient) {
+		c.compactMinSize = n
+	}
+}
+
+//打开（不存在则创建）path对应的日志文件，重放后返回client
+//默认每分钟检查一次，日志超过1MB并且无效记录超过一半时做compaction
+func NewFileStorageClient(path string, opts ...FileOption) (*FileClient, error) {
+	c := &FileClient{
+		path:            path,
+		mem:             NewRealClient(),
+		compactInterval: time.Minute,
+		compactMinSize:  1 << 20,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := c.replay(); err != nil {
+		return nil, err
+	}
+	f, err := openLogFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	c.f = f
+
+	if c.compactInterval > 0 {
+		c.stop = make(chan struct{})
+		c.done = make(chan struct{})
+		go c.compactLoop()
+	}
+	return c, nil
+}
+
+func (c *FileClient) Get(k string) (string, bool) {
+	return c.mem.Get(k)
+}
+
+func (c *FileClient) Set(k, v string) error {
+	return c.write(opSet, k, v)
+}
+
+func (c *FileClient) Delete(k string) error {
+	if !c.mem.Exists(k) {
+		return nil
+	}
+	return c.write(opDelete, k, "")
+}
+
+func (c *FileClient) Exists(k string) bool {
+	return c.mem.Exists(k)
+}
+
+func (c *FileClient) Keys() ([]string, error) {
+	return c.mem.Keys()
+}
+
+func (c *FileClient) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	return c.mem.Scan(prefix, cursor, limit)
+}
+
+//立即做一次compaction：把当前数据重写成新的日志文件，再原子地替换旧文件
+func (c *FileClient) Compact() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.broken != nil {
+		return c.closedError()
+	}
+	return c.compact()
+}
+
+//结束后台compaction，并关闭日志文件
+func (c *FileClient) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	if c.stop != nil {
+		close(c.stop)
+		<-c.done
+	}
+	if c.broken != nil {
+		return nil //旧文件在出错时已经关闭
+	}
+	if err := c.f.Sync(); err != nil {
+		c.f.Close()
+		return err
+	}
+	return c.f.Close()
+}
+
+func (c *FileClient) write(op byte, k, v string) error {
+	rec := encodeRecord(op, k, v)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.broken != nil {
+		return c.closedError()
+	}
+	if _, err := writeLog(c.f, rec); err != nil {
+		//可能已经写了一部分，不截断的话之后的记录都跟在这条坏记录后面，重放时会被一起丢掉
+		if terr := truncateLog(c.f, c.size); terr != nil {
+			c.f.Close()
+			c.broken = terr
+		}
+		return err
+	}
+	c.size += int64(len(rec))
+	c.records++
+	c.apply(op, k, v)
+	return nil
+}
+
+func (c *FileClient) apply(op byte, k, v string) {
+	switch op {
+	case opSet:
+		c.mem.Set(k, v)
+	case opDelete:
+		c.mem.Delete(k)
+	}
+}
+
+//重放日志，遇到不完整或者损坏的记录时把文件截断到最后一条完整记录
+func (c *FileClient) replay() error {
+	f, err := os.Open(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		op, k, v, n, err := readRecord(r, info.Size()-offset)
+		if err == io.EOF {
+			return nil
+		}
+		if err == errBadRecord {
+			return os.Truncate(c.path, offset)
+		}
+		if err != nil {
+			return err
+		}
+		c.apply(op, k, v)
+		offset += n
+		c.size = offset
+		c.records++
+	}
+}
+
+//调用方需要持有c.mu
+func (c *FileClient) compact() error {
+	tmp := c.path + ".compact"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	keys, _ := c.mem.Keys()
+	w := bufio.NewWriter(f)
+	var size int64
+	records := 0
+	for _, k := range keys {
+		v, ok := c.mem.Get(k)
+		if !ok {
+			continue
+		}
+		rec := encodeRecord(opSet, k, v)
+		if _, err := w.Write(rec); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+		size += int64(len(rec))
+		records++
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	//旧文件已经被替换，继续写c.f的数据都会丢失，只能把client标记为不可用
+	newF, err := openLogFile(c.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		c.f.Close()
+		c.broken = err
+		return c.closedError()
+	}
+	c.f.Close()
+	c.f = newF
+	c.size = size
+	c.records = records
+	return nil
+}
+
+//无效记录超过一半时需要compaction
+func (c *FileClient) needCompact() bool {
+	keys, _ := c.mem.Keys()
+	return c.size >= c.compactMinSize && c.records > 2*len(keys)
+}
+
+func (c *FileClient) compactLoop() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.compactInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			if !c.closed && c.broken == nil && c.needCompact() {
+				c.compact()
+			}
+			c.mu.Unlock()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+var errBadRecord = errors.New("bad record")
+
+var errFileClosed = errors.New("file storage closed")
+
+//已经关闭时Err为errFileClosed，compaction后重新打开失败时Err为当时的错误
+func (c *FileClient) closedError() error {
+	err := errFileClosed
+	if c.broken != nil {
+		err = c.broken
+	}
+	return &UnavailableError{Backend: "file " + c.path, Err: err}
+}
+
+func encodeRecord(op byte, k, v string) []byte {
+	var klen [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(klen[:], uint64(len(k)))
+
+	payload := make([]byte, 0, 1+n+len(k)+len(v))
+	payload = append(payload, op)
+	payload = append(payload, klen[:n]...)
+	payload = append(payload, k...)
+	payload = append(payload, v...)
+
+	rec := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(rec[0:4], crc32.ChecksumIEEE(payload))
+	binary.LittleEndian.PutUint32(rec[4:8], uint32(len(payload)))
+	return append(rec, payload...)
+}
+
+//读取一条记录，返回记录占用的字节数，remain为文件剩余的字节数
+//文件正好结束返回io.EOF，记录不完整或者校验失败返回errBadRecord
+func readRecord(r io.Reader, remain int64) (op byte, k, v string, n int64, err error) {
+	var header [recordHeaderSize]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errBadRecord
+		}
+		return
+	}
+	sum := binary.LittleEndian.Uint32(header[0:4])
+	size := binary.LittleEndian.Uint32(header[4:8])
+	//长度字段本身也可能损坏，不能按它直接分配内存
+	if int64(size) > remain-recordHeaderSize {
+		err = errBadRecord
+		return
+	}
+
+	payload := make([]byte, size)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errBadRecord
+		}
+		return
+	}
+	if crc32.ChecksumIEEE(payload) != sum || len(payload) == 0 {
+		err = errBadRecord
+		return
+	}
+
+	op = payload[0]
+	klen, m := binary.Uvarint(payload[1:])
+	if m <= 0 || uint64(len(payload)-1-m) < klen || (op != opSet && op != opDelete) {
+		err = errBadRecord
+		return
+	}
+	k = string(payload[1+m : 1+m+int(klen)])
+	v = string(payload[1+m+int(klen):])
+	n = int64(recordHeaderSize + len(payload))
+	return
+}
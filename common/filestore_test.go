@@ -0,0 +1,276 @@
+package common
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func tempLogPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatalf("TempDir() error = %v", err)
+	}
+	return filepath.Join(dir, "data.log"), func() { os.RemoveAll(dir) }
+}
+
+func openFileClient(t *testing.T, path string, opts ...FileOption) *FileClient {
+	opts = append([]FileOption{WithCompactInterval(0)}, opts...)
+	c, err := NewFileStorageClient(path, opts...)
+	if err != nil {
+		t.Fatalf("NewFileStorageClient() error = %v", err)
+	}
+	return c
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	return info.Size()
+}
+
+func TestFileClient(t *testing.T) {
+	convey.Convey("TestFileClient", t, func() {
+		path, cleanup := tempLogPath(t)
+		defer cleanup()
+
+		convey.Convey("survive reopen", func() {
+			c := openFileClient(t, path)
+			convey.So(c.Set("k1", "v1"), convey.ShouldBeNil)
+			convey.So(c.Set("k2", "v2"), convey.ShouldBeNil)
+			convey.So(c.Set("k1", "v1-new"), convey.ShouldBeNil)
+			convey.So(c.Delete("k2"), convey.ShouldBeNil)
+			convey.So(c.Set("", ""), convey.ShouldBeNil)
+			convey.So(c.Close(), convey.ShouldBeNil)
+
+			c = openFileClient(t, path)
+			defer c.Close()
+			v, ok := c.Get("k1")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(v, convey.ShouldEqual, "v1-new")
+			convey.So(c.Exists("k2"), convey.ShouldBeFalse)
+			convey.So(c.Exists(""), convey.ShouldBeTrue)
+			keys, err := c.Keys()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"", "k1"})
+		})
+
+		convey.Convey("closed client rejects writes", func() {
+			c := openFileClient(t, path)
+			convey.So(c.Close(), convey.ShouldBeNil)
+			err := c.Set("k1", "v1")
+			convey.So(errors.Is(err, ErrBackendUnavailable), convey.ShouldBeTrue)
+			convey.So(errors.Is(c.Compact(), ErrBackendUnavailable), convey.ShouldBeTrue)
+			convey.So(c.Close(), convey.ShouldBeNil)
+		})
+
+		convey.Convey("reopen failure after compact breaks the client", func() {
+			c := openFileClient(t, path)
+			convey.So(c.Set("k1", "v1"), convey.ShouldBeNil)
+
+			openLogFile = func(string, int, os.FileMode) (*os.File, error) {
+				return nil, errors.New("too many open files")
+			}
+			defer func() { openLogFile = os.OpenFile }()
+			err := c.Compact()
+			convey.So(errors.Is(err, ErrBackendUnavailable), convey.ShouldBeTrue)
+
+			//写入不能再悄悄追加到已经被替换掉的旧文件
+			err = c.Set("k2", "v2")
+			var uerr *UnavailableError
+			convey.So(errors.As(err, &uerr), convey.ShouldBeTrue)
+			convey.So(uerr.Err.Error(), convey.ShouldEqual, "too many open files")
+			convey.So(errors.Is(c.Delete("k1"), ErrBackendUnavailable), convey.ShouldBeTrue)
+			convey.So(c.Close(), convey.ShouldBeNil)
+
+			openLogFile = os.OpenFile
+			c = openFileClient(t, path)
+			defer c.Close()
+			convey.So(c.Exists("k1"), convey.ShouldBeTrue)
+			convey.So(c.Exists("k2"), convey.ShouldBeFalse)
+		})
+
+		convey.Convey("failed write is truncated", func() {
+			c := openFileClient(t, path)
+			convey.So(c.Set("k1", "v1"), convey.ShouldBeNil)
+
+			//只写了一半就出错
+			writeLog = func(f *os.File, b []byte) (int, error) {
+				n, _ := f.Write(b[:len(b)/2])
+				return n, errors.New("no space left on device")
+			}
+			defer func() { writeLog = (*os.File).Write }()
+			convey.So(c.Set("k2", "v2"), convey.ShouldNotBeNil)
+			convey.So(c.Exists("k2"), convey.ShouldBeFalse)
+
+			writeLog = (*os.File).Write
+			convey.So(c.Set("k3", "v3"), convey.ShouldBeNil)
+			convey.So(c.Close(), convey.ShouldBeNil)
+
+			//之后确认过的写入在重新打开后都还在
+			c = openFileClient(t, path)
+			defer c.Close()
+			keys, _ := c.Keys()
+			convey.So(keys, convey.ShouldResemble, []string{"k1", "k3"})
+		})
+
+		convey.Convey("truncate failure breaks the client", func() {
+			c := openFileClient(t, path)
+			convey.So(c.Set("k1", "v1"), convey.ShouldBeNil)
+
+			writeLog = func(f *os.File, b []byte) (int, error) {
+				n, _ := f.Write(b[:len(b)/2])
+				return n, errors.New("no space left on device")
+			}
+			truncateLog = func(*os.File, int64) error {
+				return errors.New("input/output error")
+			}
+			defer func() {
+				writeLog = (*os.File).Write
+				truncateLog = (*os.File).Truncate
+			}()
+			convey.So(c.Set("k2", "v2"), convey.ShouldNotBeNil)
+
+			writeLog = (*os.File).Write
+			err := c.Set("k3", "v3")
+			var uerr *UnavailableError
+			convey.So(errors.As(err, &uerr), convey.ShouldBeTrue)
+			convey.So(uerr.Err.Error(), convey.ShouldEqual, "input/output error")
+			convey.So(c.Close(), convey.ShouldBeNil)
+
+			//重放时丢掉不完整的记录，之前的数据还在
+			c = openFileClient(t, path)
+			defer c.Close()
+			keys, _ := c.Keys()
+			convey.So(keys, convey.ShouldResemble, []string{"k1"})
+		})
+
+		convey.Convey("compact", func() {
+			c := openFileClient(t, path)
+			for i := 0; i < 100; i++ {
+				convey.So(c.Set("k1", strconv.Itoa(i)), convey.ShouldBeNil)
+			}
+			convey.So(c.Set("k2", "v2"), convey.ShouldBeNil)
+			before := fileSize(t, path)
+			convey.So(c.Compact(), convey.ShouldBeNil)
+			convey.So(fileSize(t, path), convey.ShouldBeLessThan, before)
+
+			//compaction之后继续追加
+			convey.So(c.Set("k3", "v3"), convey.ShouldBeNil)
+			convey.So(c.Close(), convey.ShouldBeNil)
+
+			c = openFileClient(t, path)
+			defer c.Close()
+			v, _ := c.Get("k1")
+			convey.So(v, convey.ShouldEqual, "99")
+			v, _ = c.Get("k3")
+			convey.So(v, convey.ShouldEqual, "v3")
+		})
+	})
+}
+
+//模拟进程在写最后一条记录时崩溃：把日志截断在最后一条记录中间的每一个位置，都应该恢复到上一条完整的写入
+func TestFileClientRecoverTruncated(t *testing.T) {
+	path, cleanup := tempLogPath(t)
+	defer cleanup()
+
+	c := openFileClient(t, path)
+	c.Set("k1", "v1")
+	c.Set("k2", "v2")
+	c.Close()
+	good := fileSize(t, path)
+
+	c = openFileClient(t, path)
+	c.Set("k3", "a value that is long enough")
+	c.Close()
+	full := fileSize(t, path)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	for size := good + 1; size < full; size++ {
+		if err := ioutil.WriteFile(path, data[:size], 0644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		c := openFileClient(t, path)
+		if v, _ := c.Get("k2"); v != "v2" {
+			t.Errorf("size %d: Get(k2) = %v, want v2", size, v)
+		}
+		if c.Exists("k3") {
+			t.Errorf("size %d: k3 should not exist", size)
+		}
+		//日志被截断到完整记录之后，新的写入可以正常恢复
+		if err := c.Set("k4", "v4"); err != nil {
+			t.Fatalf("size %d: Set() error = %v", size, err)
+		}
+		c.Close()
+
+		c = openFileClient(t, path)
+		if v, _ := c.Get("k4"); v != "v4" {
+			t.Errorf("size %d: Get(k4) = %v, want v4", size, v)
+		}
+		c.Close()
+	}
+}
+
+//最后一条记录的内容损坏，校验失败
+func TestFileClientRecoverCorrupted(t *testing.T) {
+	path, cleanup := tempLogPath(t)
+	defer cleanup()
+
+	c := openFileClient(t, path)
+	c.Set("k1", "v1")
+	c.Set("k2", "v2")
+	c.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	ioutil.WriteFile(path, data, 0644)
+
+	c = openFileClient(t, path)
+	defer c.Close()
+	if v, _ := c.Get("k1"); v != "v1" {
+		t.Errorf("Get(k1) = %v, want v1", v)
+	}
+	if c.Exists("k2") {
+		t.Errorf("k2 should not exist")
+	}
+}
+
+func TestFileClientBackgroundCompact(t *testing.T) {
+	path, cleanup := tempLogPath(t)
+	defer cleanup()
+
+	c, err := NewFileStorageClient(path, WithCompactInterval(time.Millisecond), WithCompactMinSize(0))
+	if err != nil {
+		t.Fatalf("NewFileStorageClient() error = %v", err)
+	}
+	defer c.Close()
+	for i := 0; i < 100; i++ {
+		c.Set("k1", strconv.Itoa(i))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		records := c.records
+		c.mu.Unlock()
+		if records == 1 {
+			if v, _ := c.Get("k1"); v != "99" {
+				t.Errorf("Get(k1) = %v, want 99", v)
+			}
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("log should be compacted in background")
+}
@@ -0,0 +1,182 @@
+package common
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//LRUClient的配置
+type LRUConfig struct {
+	MaxEntries int               //最多保存的key个数，<=0表示不限
+	MaxBytes   int64             //所有key和value的总字节数上限，<=0表示不限
+	OnEvict    func(k, v string) //因为超出容量被淘汰时的回调，可以为nil，Delete不会触发
+}
+
+//单个key和value加起来就超过了LRUConfig.MaxBytes，具体错误为*EntryTooLargeError
+var ErrEntryTooLarge = errors.New("lru: entry too large")
+
+//Set的key和value超过了容量上限
+type EntryTooLargeError struct {
+	Key      string
+	Size     int64 //key和value的总字节数
+	MaxBytes int64
+}
+
+func (e *EntryTooLargeError) Error() string {
+	return fmt.Sprintf("lru: entry %q size %d exceeds MaxBytes %d", e.Key, e.Size, e.MaxBytes)
+}
+
+func (e *EntryTooLargeError) Is(target error) bool {
+	return target == ErrEntryTooLarge
+}
+
+//LRUClient的统计数据
+type LRUStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Bytes     int64
+}
+
+//容量有限的存储，超出MaxEntries或者MaxBytes后淘汰最久没有被访问的key
+//Get和Set都算一次访问，Exists、Keys、Scan不影响淘汰顺序
+type LRUClient struct {
+	mu    sync.Mutex
+	cfg   LRUConfig
+	ll    *list.List //表头是最近访问的
+	items map[string]*list.Element
+	bytes int64
+	stats LRUStats
+}
+
+type lruItem struct {
+	key   string
+	value string
+}
+
+func (it *lruItem) size() int64 {
+	return int64(len(it.key) + len(it.value))
+}
+
+func NewLRUStorageClient(cfg LRUConfig) *LRUClient {
+	return &LRUClient{
+		cfg:   cfg,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+func (c *LRUClient) Get(k string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[k]
+	if !ok {
+		c.stats.Misses++
+		return "", false
+	}
+	c.stats.Hits++
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruItem).value, true
+}
+
+//单个key和value加起来就超过MaxBytes时返回*EntryTooLargeError
+func (c *LRUClient) Set(k, v string) error {
+	item := &lruItem{key: k, value: v}
+	if c.cfg.MaxBytes > 0 && item.size() > c.cfg.MaxBytes {
+		return &EntryTooLargeError{Key: k, Size: item.size(), MaxBytes: c.cfg.MaxBytes}
+	}
+
+	c.mu.Lock()
+	if el, ok := c.items[k]; ok {
+		old := el.Value.(*lruItem)
+		c.bytes += item.size() - old.size()
+		el.Value = item
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[k] = c.ll.PushFront(item)
+		c.bytes += item.size()
+	}
+	evicted := c.evict()
+	c.mu.Unlock()
+
+	//回调在锁外执行，回调中可以再访问client
+	if c.cfg.OnEvict != nil {
+		for _, it := range evicted {
+			c.cfg.OnEvict(it.key, it.value)
+		}
+	}
+	return nil
+}
+
+func (c *LRUClient) Delete(k string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[k]; ok {
+		c.remove(el)
+	}
+	return nil
+}
+
+func (c *LRUClient) Exists(k string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.items[k]
+	return ok
+}
+
+func (c *LRUClient) Keys() ([]string, error) {
+	keys, _, err := c.Scan("", "", 0)
+	return keys, err
+}
+
+func (c *LRUClient) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.items))
+	for k := range c.items {
+		if k >= cursor && strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	c.mu.Unlock()
+
+	keys, next := scanPage(keys, limit)
+	return keys, next, nil
+}
+
+func (c *LRUClient) Stats() LRUStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.ll.Len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+//淘汰直到满足容量限制，返回被淘汰的数据，调用方需要持有c.mu
+func (c *LRUClient) evict() []*lruItem {
+	var evicted []*lruItem
+	for c.overflow() {
+		el := c.ll.Back()
+		evicted = append(evicted, el.Value.(*lruItem))
+		c.remove(el)
+		c.stats.Evictions++
+	}
+	return evicted
+}
+
+func (c *LRUClient) overflow() bool {
+	if c.cfg.MaxEntries > 0 && c.ll.Len() > c.cfg.MaxEntries {
+		return true
+	}
+	return c.cfg.MaxBytes > 0 && c.bytes > c.cfg.MaxBytes
+}
+
+func (c *LRUClient) remove(el *list.Element) {
+	item := c.ll.Remove(el).(*lruItem)
+	delete(c.items, item.key)
+	c.bytes -= item.size()
+}
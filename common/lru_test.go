@@ -0,0 +1,131 @@
+package common
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestLRUClient(t *testing.T) {
+	convey.Convey("TestLRUClient", t, func() {
+		var evicted []string
+		onEvict := func(k, v string) {
+			evicted = append(evicted, k+"="+v)
+		}
+
+		convey.Convey("evict by entries", func() {
+			client := NewLRUStorageClient(LRUConfig{MaxEntries: 2, OnEvict: onEvict})
+			client.Set("k1", "v1")
+			client.Set("k2", "v2")
+			//访问k1之后，最久没有访问的是k2
+			client.Get("k1")
+			client.Set("k3", "v3")
+
+			convey.So(evicted, convey.ShouldResemble, []string{"k2=v2"})
+			convey.So(client.Exists("k1"), convey.ShouldBeTrue)
+			convey.So(client.Exists("k2"), convey.ShouldBeFalse)
+			convey.So(client.Exists("k3"), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("evict by bytes", func() {
+			client := NewLRUStorageClient(LRUConfig{MaxBytes: 10, OnEvict: onEvict})
+			client.Set("k1", "aaa") //5字节
+			client.Set("k2", "bbb") //5字节
+			convey.So(client.Stats().Bytes, convey.ShouldEqual, 10)
+
+			//覆盖写入后变大，淘汰最久没有访问的k1
+			client.Set("k2", "bbbbbb")
+			convey.So(evicted, convey.ShouldResemble, []string{"k1=aaa"})
+			convey.So(client.Stats().Bytes, convey.ShouldEqual, 8)
+
+			err := client.Set("big", "0123456789")
+			convey.So(errors.Is(err, ErrEntryTooLarge), convey.ShouldBeTrue)
+			var terr *EntryTooLargeError
+			convey.So(errors.As(err, &terr), convey.ShouldBeTrue)
+			convey.So(*terr, convey.ShouldResemble, EntryTooLargeError{Key: "big", Size: 13, MaxBytes: 10})
+			convey.So(client.Exists("k2"), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("delete does not call OnEvict", func() {
+			client := NewLRUStorageClient(LRUConfig{MaxEntries: 1, OnEvict: onEvict})
+			client.Set("k1", "v1")
+			convey.So(client.Delete("k1"), convey.ShouldBeNil)
+			convey.So(evicted, convey.ShouldBeEmpty)
+			convey.So(client.Stats().Entries, convey.ShouldEqual, 0)
+			convey.So(client.Stats().Bytes, convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("stats", func() {
+			client := NewLRUStorageClient(LRUConfig{MaxEntries: 2})
+			client.Set("k1", "v1")
+			client.Get("k1")
+			client.Get("k1")
+			client.Get("missing")
+			client.Set("k2", "v2")
+			client.Set("k3", "v3")
+
+			convey.So(client.Stats(), convey.ShouldResemble, LRUStats{
+				Hits: 2, Misses: 1, Evictions: 1, Entries: 2, Bytes: 8,
+			})
+		})
+
+		convey.Convey("keys and scan", func() {
+			client := NewLRUStorageClient(LRUConfig{})
+			for _, k := range []string{"b", "a", "c"} {
+				client.Set(k, "v")
+			}
+			keys, _ := client.Keys()
+			convey.So(keys, convey.ShouldResemble, []string{"a", "b", "c"})
+			keys, next, _ := client.Scan("", "", 2)
+			convey.So(keys, convey.ShouldResemble, []string{"a", "b"})
+			keys, next, _ = client.Scan("", next, 2)
+			convey.So(keys, convey.ShouldResemble, []string{"c"})
+			convey.So(next, convey.ShouldEqual, "")
+		})
+
+		convey.Convey("callback may use the client", func() {
+			var client *LRUClient
+			client = NewLRUStorageClient(LRUConfig{MaxEntries: 1, OnEvict: func(k, v string) {
+				client.Exists(k)
+			}})
+			client.Set("k1", "v1")
+			client.Set("k2", "v2")
+			convey.So(client.Stats().Evictions, convey.ShouldEqual, 1)
+		})
+	})
+}
+
+func TestLRUClientStress(t *testing.T) {
+	var mu sync.Mutex
+	evictions := 0
+	client := NewLRUStorageClient(LRUConfig{MaxEntries: 50, OnEvict: func(_, _ string) {
+		mu.Lock()
+		evictions++
+		mu.Unlock()
+	}})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				k := strconv.Itoa(g*1000 + i%100)
+				client.Set(k, "v")
+				client.Get(k)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	stats := client.Stats()
+	if stats.Entries > 50 {
+		t.Errorf("Entries = %d, want <= 50", stats.Entries)
+	}
+	if uint64(evictions) != stats.Evictions {
+		t.Errorf("OnEvict called %d times, Evictions = %d", evictions, stats.Evictions)
+	}
+}
@@ -0,0 +1,228 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//默认的耗时分桶，单位秒
+var DefaultLatencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+//被统计的方法，输出时按这个顺序
+var instrumentedMethods = []string{"Get", "Set", "Delete", "Exists", "Keys", "Scan"}
+
+//InstrumentedClient的可选配置
+type MetricsOption func(*InstrumentedClient)
+
+//计算耗时用的时钟，不设置则使用SystemClock
+func WithMetricsClock(c Clock) MetricsOption {
+	return func(m *InstrumentedClient) {
+		m.clock = c
+	}
+}
+
+//耗时分桶的上界，单位秒
+//会复制一份再从小到大排序，去掉重复值、NaN和+Inf(+Inf桶总是存在)，之后修改buckets不影响统计
+func WithLatencyBuckets(buckets []float64) MetricsOption {
+	sorted := make([]float64, 0, len(buckets))
+	for _, b := range buckets {
+		if !math.IsNaN(b) && !math.IsInf(b, 1) {
+			sorted = append(sorted, b)
+		}
+	}
+	sort.Float64s(sorted)
+	n := 0
+	for i, b := range sorted {
+		if i == 0 || b != sorted[n-1] {
+			sorted[n] = b
+			n++
+		}
+	}
+	sorted = sorted[:n]
+	return func(m *InstrumentedClient) {
+		m.buckets = sorted
+	}
+}
+
+//包装任意StorageClient，统计每个方法的调用次数、错误次数、耗时分布，以及Get的命中率
+//通过Handler以Prometheus文本格式暴露
+type InstrumentedClient struct {
+	c       StorageClient
+	clock   Clock
+	buckets []float64
+
+	mu      sync.Mutex
+	methods map[string]*methodMetrics
+	hits    uint64
+	misses  uint64
+}
+
+type methodMetrics struct {
+	calls  uint64
+	errors uint64
+	counts []uint64 //每个桶的个数，不累加，最后一个是+Inf
+	sum    float64
+}
+
+func NewInstrumentedClient(c StorageClient, opts ...MetricsOption) *InstrumentedClient {
+	m := &InstrumentedClient{
+		c:       c,
+		clock:   SystemClock,
+		buckets: DefaultLatencyBuckets,
+		methods: map[string]*methodMetrics{},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	for _, name := range instrumentedMethods {
+		m.methods[name] = &methodMetrics{counts: make([]uint64, len(m.buckets)+1)}
+	}
+	return m
+}
+
+func (m *InstrumentedClient) Get(k string) (string, bool) {
+	start := m.clock.Now()
+	v, ok := m.c.Get(k)
+	m.observe("Get", start, nil)
+
+	m.mu.Lock()
+	if ok {
+		m.hits++
+	} else {
+		m.misses++
+	}
+	m.mu.Unlock()
+	return v, ok
+}
+
+func (m *InstrumentedClient) Set(k, v string) error {
+	start := m.clock.Now()
+	err := m.c.Set(k, v)
+	m.observe("Set", start, err)
+	return err
+}
+
+func (m *InstrumentedClient) Delete(k string) error {
+	start := m.clock.Now()
+	err := m.c.Delete(k)
+	m.observe("Delete", start, err)
+	return err
+}
+
+func (m *InstrumentedClient) Exists(k string) bool {
+	start := m.clock.Now()
+	ok := m.c.Exists(k)
+	m.observe("Exists", start, nil)
+	return ok
+}
+
+func (m *InstrumentedClient) Keys() ([]string, error) {
+	start := m.clock.Now()
+	keys, err := m.c.Keys()
+	m.observe("Keys", start, err)
+	return keys, err
+}
+
+func (m *InstrumentedClient) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	start := m.clock.Now()
+	keys, next, err := m.c.Scan(prefix, cursor, limit)
+	m.observe("Scan", start, err)
+	return keys, next, err
+}
+
+func (m *InstrumentedClient) observe(method string, start time.Time, err error) {
+	seconds := m.clock.Now().Sub(start).Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mm := m.methods[method]
+	mm.calls++
+	if err != nil {
+		mm.errors++
+	}
+	mm.sum += seconds
+	i := 0
+	for i < len(m.buckets) && seconds > m.buckets[i] {
+		i++
+	}
+	mm.counts[i]++
+}
+
+//在锁内复制一份当前的统计数据
+func (m *InstrumentedClient) snapshot() (methods map[string]methodMetrics, hits, misses uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	methods = make(map[string]methodMetrics, len(m.methods))
+	for name, mm := range m.methods {
+		cp := *mm
+		cp.counts = append([]uint64(nil), mm.counts...)
+		methods[name] = cp
+	}
+	return methods, m.hits, m.misses
+}
+
+//以Prometheus文本格式输出当前的统计数据
+//先复制一份数据再写w，写得慢的w不会阻塞被统计的调用
+func (m *InstrumentedClient) WriteMetrics(w io.Writer) error {
+	methods, hits, misses := m.snapshot()
+
+	bw := bufio.NewWriter(w)
+	header := func(name, typ, help string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	header("storage_calls_total", "counter", "Number of StorageClient calls.")
+	for _, name := range instrumentedMethods {
+		fmt.Fprintf(bw, "storage_calls_total{method=%q} %d\n", name, methods[name].calls)
+	}
+
+	header("storage_errors_total", "counter", "Number of StorageClient calls that returned an error.")
+	for _, name := range instrumentedMethods {
+		fmt.Fprintf(bw, "storage_errors_total{method=%q} %d\n", name, methods[name].errors)
+	}
+
+	header("storage_get_hits_total", "counter", "Number of Get calls that found the key.")
+	fmt.Fprintf(bw, "storage_get_hits_total %d\n", hits)
+	header("storage_get_misses_total", "counter", "Number of Get calls that missed the key.")
+	fmt.Fprintf(bw, "storage_get_misses_total %d\n", misses)
+	header("storage_get_hit_ratio", "gauge", "Ratio of Get calls that found the key.")
+	ratio := 0.0
+	if total := hits + misses; total > 0 {
+		ratio = float64(hits) / float64(total)
+	}
+	fmt.Fprintf(bw, "storage_get_hit_ratio %s\n", formatFloat(ratio))
+
+	header("storage_call_duration_seconds", "histogram", "Latency of StorageClient calls.")
+	for _, name := range instrumentedMethods {
+		mm := methods[name]
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += mm.counts[i]
+			fmt.Fprintf(bw, "storage_call_duration_seconds_bucket{method=%q,le=%q} %d\n", name, formatFloat(le), cumulative)
+		}
+		cumulative += mm.counts[len(m.buckets)]
+		fmt.Fprintf(bw, "storage_call_duration_seconds_bucket{method=%q,le=\"+Inf\"} %d\n", name, cumulative)
+		fmt.Fprintf(bw, "storage_call_duration_seconds_sum{method=%q} %s\n", name, formatFloat(mm.sum))
+		fmt.Fprintf(bw, "storage_call_duration_seconds_count{method=%q} %d\n", name, mm.calls)
+	}
+	return bw.Flush()
+}
+
+//暴露统计数据的http handler，可以直接挂在/metrics上
+func (m *InstrumentedClient) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WriteMetrics(w)
+	})
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
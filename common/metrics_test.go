@@ -0,0 +1,132 @@
+package common
+
+import (
+	"errors"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+//每次调用都把时钟拨动固定的时间，用来模拟耗时
+type slowClient struct {
+	StorageClient
+	clock *FakeClock
+	cost  time.Duration
+	err   error
+}
+
+func (c *slowClient) Get(k string) (string, bool) {
+	c.clock.Advance(c.cost)
+	return c.StorageClient.Get(k)
+}
+
+func (c *slowClient) Set(k, v string) error {
+	c.clock.Advance(c.cost)
+	if c.err != nil {
+		return c.err
+	}
+	return c.StorageClient.Set(k, v)
+}
+
+//每次Write都调用一次client.Get，WriteMetrics持有锁写w时会死锁
+type reentrantWriter struct {
+	client *InstrumentedClient
+	buf    strings.Builder
+}
+
+func (w *reentrantWriter) Write(p []byte) (int, error) {
+	w.client.Get("k")
+	return w.buf.Write(p)
+}
+
+func TestInstrumentedClient(t *testing.T) {
+	convey.Convey("TestInstrumentedClient", t, func() {
+		clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		inner := &slowClient{StorageClient: NewRealClient(), clock: clock, cost: 2 * time.Millisecond}
+		client := NewInstrumentedClient(inner, WithMetricsClock(clock), WithLatencyBuckets([]float64{0.001, 0.01}))
+
+		client.Set("k1", "v1")
+		client.Get("k1")
+		client.Get("k1")
+		client.Get("missing")
+		inner.err = errors.New("boom")
+		inner.cost = 20 * time.Millisecond
+		client.Set("k2", "v2")
+		client.Exists("k1")
+
+		rec := httptest.NewRecorder()
+		client.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		body := rec.Body.String()
+		convey.So(rec.Header().Get("Content-Type"), convey.ShouldStartWith, "text/plain")
+
+		convey.Convey("calls and errors", func() {
+			convey.So(body, convey.ShouldContainSubstring, `storage_calls_total{method="Get"} 3`)
+			convey.So(body, convey.ShouldContainSubstring, `storage_calls_total{method="Set"} 2`)
+			convey.So(body, convey.ShouldContainSubstring, `storage_calls_total{method="Exists"} 1`)
+			convey.So(body, convey.ShouldContainSubstring, `storage_calls_total{method="Delete"} 0`)
+			convey.So(body, convey.ShouldContainSubstring, `storage_errors_total{method="Set"} 1`)
+			convey.So(body, convey.ShouldContainSubstring, `storage_errors_total{method="Get"} 0`)
+		})
+
+		convey.Convey("hit ratio", func() {
+			convey.So(body, convey.ShouldContainSubstring, "storage_get_hits_total 2\n")
+			convey.So(body, convey.ShouldContainSubstring, "storage_get_misses_total 1\n")
+			convey.So(body, convey.ShouldContainSubstring, "storage_get_hit_ratio 0.6666666666666666\n")
+		})
+
+		convey.Convey("latency histogram", func() {
+			//Set一次2ms，一次20ms
+			convey.So(body, convey.ShouldContainSubstring, `storage_call_duration_seconds_bucket{method="Set",le="0.001"} 0`)
+			convey.So(body, convey.ShouldContainSubstring, `storage_call_duration_seconds_bucket{method="Set",le="0.01"} 1`)
+			convey.So(body, convey.ShouldContainSubstring, `storage_call_duration_seconds_bucket{method="Set",le="+Inf"} 2`)
+			convey.So(body, convey.ShouldContainSubstring, `storage_call_duration_seconds_sum{method="Set"} 0.022`)
+			convey.So(body, convey.ShouldContainSubstring, `storage_call_duration_seconds_count{method="Set"} 2`)
+			//Exists没有耗时
+			convey.So(body, convey.ShouldContainSubstring, `storage_call_duration_seconds_bucket{method="Exists",le="0.001"} 1`)
+		})
+
+		convey.Convey("every metric has TYPE", func() {
+			for _, name := range []string{"storage_calls_total", "storage_errors_total", "storage_get_hit_ratio", "storage_call_duration_seconds"} {
+				convey.So(body, convey.ShouldContainSubstring, "# TYPE "+name+" ")
+			}
+			convey.So(strings.HasSuffix(body, "\n"), convey.ShouldBeTrue)
+		})
+	})
+}
+
+func TestInstrumentedClientBuckets(t *testing.T) {
+	convey.Convey("TestInstrumentedClientBuckets", t, func() {
+		convey.Convey("buckets are copied and sorted", func() {
+			buckets := []float64{0.01, math.Inf(1), 0.001, math.NaN(), 0.01}
+			client := NewInstrumentedClient(NewRealClient(), WithLatencyBuckets(buckets))
+			buckets[0] = 100
+
+			var buf strings.Builder
+			convey.So(client.WriteMetrics(&buf), convey.ShouldBeNil)
+			body := buf.String()
+			i := strings.Index(body, `storage_call_duration_seconds_bucket{method="Get",le="0.001"}`)
+			j := strings.Index(body, `storage_call_duration_seconds_bucket{method="Get",le="0.01"}`)
+			k := strings.Index(body, `storage_call_duration_seconds_bucket{method="Get",le="+Inf"}`)
+			convey.So(i, convey.ShouldBeGreaterThan, 0)
+			convey.So(j, convey.ShouldBeGreaterThan, i)
+			convey.So(k, convey.ShouldBeGreaterThan, j)
+			convey.So(strings.Count(body, `storage_call_duration_seconds_bucket{method="Get"`), convey.ShouldEqual, 3)
+			convey.So(body, convey.ShouldNotContainSubstring, `le="100"`)
+		})
+
+		convey.Convey("writing does not hold the lock", func() {
+			client := NewInstrumentedClient(NewRealClient())
+			w := &reentrantWriter{client: client}
+			convey.So(client.WriteMetrics(w), convey.ShouldBeNil)
+			convey.So(w.buf.String(), convey.ShouldContainSubstring, `storage_calls_total{method="Get"} 0`)
+
+			var buf strings.Builder
+			client.WriteMetrics(&buf)
+			convey.So(buf.String(), convey.ShouldNotContainSubstring, `storage_calls_total{method="Get"} 0`)
+		})
+	})
+}
@@ -0,0 +1,177 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+ * 流式读取NDJSON(每行一个JSON对象)格式的Movie，内存占用只和单行的长度有关
+ *   s := NewMovieScanner(r)
+ *   for s.Next() {
+ *       m := s.Movie()
+ *   }
+ *   if err := s.Err(); err != nil {...}
+ * 空行(包括只有空白的行)会被忽略，行尾的\r\n按\n处理
+ */
+
+//单行的默认长度上限
+const DefaultMaxLineSize = 1 << 20
+
+//行的长度超过了上限
+var ErrLineTooLong = errors.New("ndjson: line too long")
+
+//某一行解析失败，Line从1开始
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("ndjson: line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+//MovieScanner的可选配置
+type NDJSONOption func(*MovieScanner)
+
+//跳过解析失败的行，而不是停止读取，onSkip可以为nil
+//读取本身出错(例如连接断开)时仍然会停止
+func WithSkipBadLines(onSkip func(*LineError)) NDJSONOption {
+	return func(s *MovieScanner) {
+		s.skipBad = true
+		s.onSkip = onSkip
+	}
+}
+
+//单行的长度上限(不包括换行符)，n<=0表示使用DefaultMaxLineSize
+func WithMaxLineSize(n int) NDJSONOption {
+	return func(s *MovieScanner) {
+		s.maxLine = n
+	}
+}
+
+//解析每一行用的Decoder，默认为JSONCodec{}
+func WithLineDecoder(d Decoder) NDJSONOption {
+	return func(s *MovieScanner) {
+		s.dec = d
+	}
+}
+
+//逐行读取Movie的迭代器，不能在多个goroutine中同时使用
+type MovieScanner struct {
+	r       *bufio.Reader
+	dec     Decoder
+	maxLine int
+	skipBad bool
+	onSkip  func(*LineError)
+
+	line    int
+	movie   Movie
+	skipped int
+	err     error
+}
+
+func NewMovieScanner(r io.Reader, opts ...NDJSONOption) *MovieScanner {
+	s := &MovieScanner{r: bufio.NewReader(r), dec: JSONCodec{}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.maxLine <= 0 {
+		s.maxLine = DefaultMaxLineSize
+	}
+	return s
+}
+
+//读取下一个Movie，读完或者出错时返回false，之后通过Err区分
+func (s *MovieScanner) Next() bool {
+	for s.err == nil {
+		b, err := s.readLine()
+		if err == io.EOF && b == nil {
+			return false
+		}
+		if err != nil && err != io.EOF && err != ErrLineTooLong {
+			s.err = err
+			return false
+		}
+		s.line++
+
+		if err == nil || err == io.EOF {
+			b = bytes.TrimSpace(b)
+			if len(b) == 0 {
+				continue
+			}
+			var m Movie
+			if err = s.dec.Unmarshal(b, &m); err == nil {
+				s.movie = m
+				return true
+			}
+		}
+
+		lerr := &LineError{Line: s.line, Err: err}
+		if !s.skipBad {
+			s.err = lerr
+			return false
+		}
+		s.skipped++
+		if s.onSkip != nil {
+			s.onSkip(lerr)
+		}
+	}
+	return false
+}
+
+//最近一次Next读到的Movie
+func (s *MovieScanner) Movie() Movie {
+	return s.movie
+}
+
+//最近一次Next读到的行号，从1开始
+func (s *MovieScanner) Line() int {
+	return s.line
+}
+
+//跳过的行数
+func (s *MovieScanner) Skipped() int {
+	return s.skipped
+}
+
+//第一个导致停止的错误，正常读完返回nil
+//某一行解析失败时为*LineError
+func (s *MovieScanner) Err() error {
+	return s.err
+}
+
+//读一行，不包括换行符
+//最后一行没有换行符时返回这一行和io.EOF，没有数据时返回nil和io.EOF
+//超过maxLine时丢弃这一行剩下的部分，返回ErrLineTooLong，下一次从下一行开始读
+func (s *MovieScanner) readLine() ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := s.r.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			if len(bytes.TrimRight(line, "\r\n")) > s.maxLine {
+				tooLong = true
+				line = nil
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if tooLong && (err == nil || err == io.EOF) {
+			return nil, ErrLineTooLong
+		}
+		if err == io.EOF && len(line) == 0 {
+			return nil, io.EOF
+		}
+		return line, err
+	}
+}
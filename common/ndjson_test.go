@@ -0,0 +1,127 @@
+package common
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func scanMovies(s *MovieScanner) []Movie {
+	var movies []Movie
+	for s.Next() {
+		movies = append(movies, s.Movie())
+	}
+	return movies
+}
+
+func TestMovieScanner(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		skip     bool
+		want     []string //读到的Name
+		wantLine int      //出错的行号，0表示不出错
+		skipped  int
+	}{
+		{"empty", "", false, nil, 0, 0},
+		{"one line without newline", `{"Name":"a"}`, false, []string{"a"}, 0, 0},
+		{"crlf and blank lines", "{\"Name\":\"a\"}\r\n\r\n  \n{\"Name\":\"b\"}\r\n", false, []string{"a", "b"}, 0, 0},
+		{"stop at bad line", "{\"Name\":\"a\"}\n{bad\n{\"Name\":\"c\"}\n", false, []string{"a"}, 2, 0},
+		{"wrong type", "{\"Name\":\"a\",\"Score\":\"high\"}\n", false, nil, 1, 0},
+		{"skip bad lines", "{bad\n{\"Name\":\"b\"}\n[]\n\n{\"Name\":\"e\"}", true, []string{"b", "e"}, 0, 2},
+		{"two objects on one line", `{"Name":"a"} {"Name":"b"}`, false, nil, 1, 0},
+	}
+	for _, tt := range tests {
+		var opts []NDJSONOption
+		if tt.skip {
+			opts = append(opts, WithSkipBadLines(nil))
+		}
+		s := NewMovieScanner(strings.NewReader(tt.input), opts...)
+		var names []string
+		for _, m := range scanMovies(s) {
+			names = append(names, m.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %v, want %v", tt.name, names, tt.want)
+		}
+		var lerr *LineError
+		if tt.wantLine == 0 {
+			if s.Err() != nil {
+				t.Errorf("%s: Err() = %v, want nil", tt.name, s.Err())
+			}
+		} else if !errors.As(s.Err(), &lerr) || lerr.Line != tt.wantLine {
+			t.Errorf("%s: Err() = %v, want LineError at line %d", tt.name, s.Err(), tt.wantLine)
+		}
+		if s.Skipped() != tt.skipped {
+			t.Errorf("%s: Skipped() = %d, want %d", tt.name, s.Skipped(), tt.skipped)
+		}
+	}
+}
+
+func TestMovieScannerOptions(t *testing.T) {
+	convey.Convey("TestMovieScannerOptions", t, func() {
+		convey.Convey("line numbers of skipped lines", func() {
+			var skipped []*LineError
+			input := "{\"Name\":\"a\"}\n\n{bad\n{\"Name\":\"d\"}\nnull x\n"
+			s := NewMovieScanner(strings.NewReader(input), WithSkipBadLines(func(e *LineError) {
+				skipped = append(skipped, e)
+			}))
+			convey.So(s.Next(), convey.ShouldBeTrue)
+			convey.So(s.Line(), convey.ShouldEqual, 1)
+			convey.So(s.Next(), convey.ShouldBeTrue)
+			convey.So(s.Line(), convey.ShouldEqual, 4)
+			convey.So(s.Next(), convey.ShouldBeFalse)
+			convey.So(s.Err(), convey.ShouldBeNil)
+			convey.So(len(skipped), convey.ShouldEqual, 2)
+			convey.So(skipped[0].Line, convey.ShouldEqual, 3)
+			convey.So(skipped[1].Line, convey.ShouldEqual, 5)
+			convey.So(skipped[0].Error(), convey.ShouldStartWith, "ndjson: line 3: ")
+		})
+
+		convey.Convey("line too long", func() {
+			long := `{"Name":"` + strings.Repeat("x", 100) + `"}`
+			input := long + "\n{\"Name\":\"b\"}\n" + long
+			s := NewMovieScanner(strings.NewReader(input), WithMaxLineSize(50))
+			convey.So(s.Next(), convey.ShouldBeFalse)
+			convey.So(errors.Is(s.Err(), ErrLineTooLong), convey.ShouldBeTrue)
+
+			//超长的行被丢弃后可以继续读下一行
+			s = NewMovieScanner(iotest.OneByteReader(strings.NewReader(input)), WithMaxLineSize(50), WithSkipBadLines(nil))
+			convey.So(scanMovies(s), convey.ShouldResemble, []Movie{{Name: "b"}})
+			convey.So(s.Skipped(), convey.ShouldEqual, 2)
+			convey.So(s.Line(), convey.ShouldEqual, 3)
+
+			//刚好等于上限不算超长
+			s = NewMovieScanner(strings.NewReader(long+"\r\n"), WithMaxLineSize(len(long)))
+			convey.So(len(scanMovies(s)), convey.ShouldEqual, 1)
+			convey.So(s.Err(), convey.ShouldBeNil)
+		})
+
+		convey.Convey("line longer than the read buffer", func() {
+			name := strings.Repeat("x", 10000)
+			s := NewMovieScanner(strings.NewReader(`{"Name":"` + name + `"}`))
+			convey.So(scanMovies(s), convey.ShouldResemble, []Movie{{Name: name}})
+		})
+
+		convey.Convey("custom line decoder", func() {
+			input := "{\"Name\":\"a\",\"Year\":1997}\n{\"Name\":\"b\"}\n"
+			s := NewMovieScanner(strings.NewReader(input),
+				WithLineDecoder(JSONCodec{DisallowUnknownFields: true}), WithSkipBadLines(nil))
+			convey.So(scanMovies(s), convey.ShouldResemble, []Movie{{Name: "b"}})
+			convey.So(s.Skipped(), convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("read error stops even when skipping", func() {
+			r := io.MultiReader(strings.NewReader("{\"Name\":\"a\"}\n{\"Na"), iotest.TimeoutReader(strings.NewReader("x")))
+			s := NewMovieScanner(r, WithSkipBadLines(nil))
+			convey.So(s.Next(), convey.ShouldBeTrue)
+			convey.So(s.Next(), convey.ShouldBeFalse)
+			convey.So(s.Err(), convey.ShouldEqual, iotest.ErrTimeout)
+			convey.So(s.Next(), convey.ShouldBeFalse)
+		})
+	})
+}
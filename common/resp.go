@@ -0,0 +1,359 @@
+package common
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * RESP(Redis Serialization Protocol)编解码，以及基于它的StorageClient
+ *   请求：由bulk string组成的数组，*<n>\r\n$<len>\r\n<data>\r\n...
+ *   响应：+简单字符串  -错误  :整数  $bulk string($-1表示nil)  *数组
+ */
+
+//单个bulk string和数组的长度上限，对端声明的长度超过上限时返回ErrRESPProtocol，避免按对端给的长度无限制地分配内存
+const (
+	maxRESPBulkLen  = 64 << 20
+	maxRESPArrayLen = 1 << 20
+)
+
+//对端发送的数据不符合协议或者超过长度上限
+var ErrRESPProtocol = errors.New("resp: protocol error")
+
+//服务端返回的-ERR响应
+type RESPError string
+
+func (e RESPError) Error() string {
+	return string(e)
+}
+
+//写一条命令
+func writeRESPCommand(w *bufio.Writer, args ...string) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return w.Flush()
+}
+
+//读一条响应
+//简单字符串和bulk string返回string，nil返回nil，整数返回int64，数组返回[]interface{}，错误返回RESPError
+func readRESPReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("resp: empty line")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return RESPError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("resp: bad bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > maxRESPBulkLen {
+			return nil, fmt.Errorf("%w: bulk length %d exceeds %d", ErrRESPProtocol, n, maxRESPBulkLen)
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[n] != '\r' || buf[n+1] != '\n' {
+			return nil, fmt.Errorf("%w: bulk string of length %d not terminated by CRLF", ErrRESPProtocol, n)
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("resp: bad array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > maxRESPArrayLen {
+			return nil, fmt.Errorf("%w: array length %d exceeds %d", ErrRESPProtocol, n, maxRESPArrayLen)
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			if arr[i], err = readRESPReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	}
+	return nil, fmt.Errorf("resp: unknown reply type %q", line)
+}
+
+//读一条请求，只接受bulk string数组
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	reply, err := readRESPReply(r)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := reply.([]interface{})
+	if !ok || len(arr) == 0 {
+		return nil, errors.New("resp: command must be a non-empty array")
+	}
+	args := make([]string, len(arr))
+	for i, a := range arr {
+		if args[i], ok = a.(string); !ok {
+			return nil, errors.New("resp: command arguments must be bulk strings")
+		}
+	}
+	return args, nil
+}
+
+func readRESPLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", errors.New("resp: line must end with CRLF")
+	}
+	return line[:len(line)-2], nil
+}
+
+//把任意字符串转义成只匹配它本身的glob模式
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+//通过RESP协议访问远端存储的client，单连接，请求串行发送
+//连接出错后关闭，下一次调用时重连，Close之后不再重连
+type RESPClient struct {
+	mu      sync.Mutex
+	addr    string
+	timeout time.Duration
+	closed  bool
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+}
+
+//RESPClient的可选配置
+type RESPOption func(*RESPClient)
+
+//连接以及每次请求的超时时间，默认5秒
+func WithRESPTimeout(d time.Duration) RESPOption {
+	return func(c *RESPClient) {
+		c.timeout = d
+	}
+}
+
+//连接addr上的RESP服务
+func NewRESPStorageClient(addr string, opts ...RESPOption) (*RESPClient, error) {
+	c := &RESPClient{addr: addr, timeout: 5 * time.Second}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+//发送一条命令并等待响应，服务端返回的错误作为RESPError返回
+//连接失败或者读写出错时返回*UnavailableError，errors.Is(err, ErrBackendUnavailable)为true
+func (c *RESPClient) Do(args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, c.unavailable(errRESPClosed)
+	}
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+	if c.timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	if err := writeRESPCommand(c.w, args...); err != nil {
+		c.reset()
+		return nil, c.unavailable(err)
+	}
+	reply, err := readRESPReply(c.r)
+	if err != nil {
+		c.reset()
+		return nil, c.unavailable(err)
+	}
+	if e, ok := reply.(RESPError); ok {
+		return nil, e
+	}
+	return reply, nil
+}
+
+func (c *RESPClient) Get(k string) (string, bool) {
+	reply, err := c.Do("GET", k)
+	if err != nil {
+		return "", false
+	}
+	v, ok := reply.(string)
+	return v, ok
+}
+
+func (c *RESPClient) Set(k, v string) error {
+	_, err := c.Do("SET", k, v)
+	return err
+}
+
+func (c *RESPClient) Delete(k string) error {
+	_, err := c.Do("DEL", k)
+	return err
+}
+
+func (c *RESPClient) Exists(k string) bool {
+	reply, err := c.Do("EXISTS", k)
+	if err != nil {
+		return false
+	}
+	n, _ := reply.(int64)
+	return n > 0
+}
+
+//设置过期时间，对应PEXPIRE命令，精度为毫秒，不足1毫秒的部分向上取整，k不存在返回false
+//和Redis一样，ttl<=0时直接删除k
+func (c *RESPClient) Expire(k string, ttl time.Duration) (bool, error) {
+	ms := int64(ttl / time.Millisecond)
+	if ttl > 0 && ttl%time.Millisecond != 0 {
+		ms++
+	}
+	reply, err := c.Do("PEXPIRE", k, strconv.FormatInt(ms, 10))
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n > 0, nil
+}
+
+func (c *RESPClient) Keys() ([]string, error) {
+	reply, err := c.Do("KEYS", "*")
+	if err != nil {
+		return nil, err
+	}
+	keys, err := respStrings(reply)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+//对应SCAN命令，RESP的游标"0"对应这里的空串
+//limit<=0时一直遍历到结束
+func (c *RESPClient) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	if cursor == "" {
+		cursor = "0"
+	}
+	var keys []string
+	for {
+		args := []string{"SCAN", cursor, "MATCH", globEscape(prefix) + "*"}
+		if limit > 0 {
+			args = append(args, "COUNT", strconv.Itoa(limit))
+		}
+		reply, err := c.Do(args...)
+		if err != nil {
+			return nil, "", err
+		}
+		arr, ok := reply.([]interface{})
+		if !ok || len(arr) != 2 {
+			return nil, "", fmt.Errorf("resp: unexpected SCAN reply %v", reply)
+		}
+		next, _ := arr[0].(string)
+		batch, err := respStrings(arr[1])
+		if err != nil {
+			return nil, "", err
+		}
+		keys = append(keys, batch...)
+		if next == "0" {
+			next = ""
+		}
+		if limit > 0 || next == "" {
+			return keys, next, nil
+		}
+		cursor = next
+	}
+}
+
+//关闭之后的调用都返回*UnavailableError
+func (c *RESPClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+//调用方需要持有c.mu
+func (c *RESPClient) connect() error {
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return c.unavailable(err)
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+	c.w = bufio.NewWriter(conn)
+	return nil
+}
+
+var errRESPClosed = errors.New("client closed")
+
+//连接或者读写出错，包装成UnavailableError，服务端返回的RESPError不在此列
+func (c *RESPClient) unavailable(err error) error {
+	return &UnavailableError{Backend: "resp " + c.addr, Err: err}
+}
+
+//调用方需要持有c.mu
+func (c *RESPClient) reset() {
+	c.conn.Close()
+	c.conn = nil
+}
+
+func respStrings(reply interface{}) ([]string, error) {
+	arr, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("resp: expect array, got %v", reply)
+	}
+	ss := make([]string, 0, len(arr))
+	for _, a := range arr {
+		s, ok := a.(string)
+		if !ok {
+			return nil, fmt.Errorf("resp: expect bulk string, got %v", a)
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
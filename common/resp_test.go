@@ -0,0 +1,230 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func startRESP(t *testing.T, store *RealClient) (*RESPServer, *RESPClient) {
+	server, err := StartRESPServer("127.0.0.1:0", store)
+	if err != nil {
+		t.Fatalf("StartRESPServer() error = %v", err)
+	}
+	client, err := NewRESPStorageClient(server.Addr(), WithRESPTimeout(time.Second))
+	if err != nil {
+		server.Close()
+		t.Fatalf("NewRESPStorageClient() error = %v", err)
+	}
+	return server, client
+}
+
+func TestRESPProtocol(t *testing.T) {
+	convey.Convey("TestRESPProtocol", t, func() {
+		convey.Convey("command round trip", func() {
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+			convey.So(writeRESPCommand(w, "SET", "k\r\n1", ""), convey.ShouldBeNil)
+			convey.So(buf.String(), convey.ShouldEqual, "*3\r\n$3\r\nSET\r\n$4\r\nk\r\n1\r\n$0\r\n\r\n")
+
+			args, err := readRESPCommand(bufio.NewReader(&buf))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(args, convey.ShouldResemble, []string{"SET", "k\r\n1", ""})
+		})
+
+		convey.Convey("replies", func() {
+			r := bufio.NewReader(bytes.NewBufferString("+OK\r\n-ERR boom\r\n:42\r\n$-1\r\n*2\r\n$1\r\na\r\n:1\r\n"))
+			reply, _ := readRESPReply(r)
+			convey.So(reply, convey.ShouldEqual, "OK")
+			reply, _ = readRESPReply(r)
+			convey.So(reply, convey.ShouldEqual, RESPError("ERR boom"))
+			reply, _ = readRESPReply(r)
+			convey.So(reply, convey.ShouldEqual, int64(42))
+			reply, _ = readRESPReply(r)
+			convey.So(reply, convey.ShouldBeNil)
+			reply, _ = readRESPReply(r)
+			convey.So(reply, convey.ShouldResemble, []interface{}{"a", int64(1)})
+		})
+
+		convey.Convey("bad input", func() {
+			_, err := readRESPReply(bufio.NewReader(bytes.NewBufferString("?\r\n")))
+			convey.So(err, convey.ShouldNotBeNil)
+			_, err = readRESPCommand(bufio.NewReader(bytes.NewBufferString(":1\r\n")))
+			convey.So(err, convey.ShouldNotBeNil)
+
+			//对端声明的长度超过上限，不能按这个长度分配内存
+			_, err = readRESPReply(bufio.NewReader(bytes.NewBufferString("$9999999999\r\n")))
+			convey.So(errors.Is(err, ErrRESPProtocol), convey.ShouldBeTrue)
+			_, err = readRESPCommand(bufio.NewReader(bytes.NewBufferString("*9999999999\r\n")))
+			convey.So(errors.Is(err, ErrRESPProtocol), convey.ShouldBeTrue)
+
+			//bulk string后面必须是CRLF
+			_, err = readRESPReply(bufio.NewReader(bytes.NewBufferString("$2\r\nabcd\r\n")))
+			convey.So(errors.Is(err, ErrRESPProtocol), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("glob", func() {
+			convey.So(globMatch("user:*", "user:1"), convey.ShouldBeTrue)
+			convey.So(globMatch("user:*", "movie:1"), convey.ShouldBeFalse)
+			convey.So(globMatch("u?er*", "user:1"), convey.ShouldBeTrue)
+			convey.So(globMatch(globEscape("a*[b]?")+"*", "a*[b]?c"), convey.ShouldBeTrue)
+			convey.So(globMatch(globEscape("a*")+"*", "abc"), convey.ShouldBeFalse)
+		})
+	})
+}
+
+func TestRESPClient(t *testing.T) {
+	convey.Convey("TestRESPClient", t, func() {
+		clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		server, client := startRESP(t, NewRealClient(WithClock(clock)))
+		defer server.Close()
+		defer client.Close()
+
+		convey.Convey("get set delete", func() {
+			_, ok := client.Get("k1")
+			convey.So(ok, convey.ShouldBeFalse)
+			convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+			v, ok := client.Get("k1")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(v, convey.ShouldEqual, "v1")
+			convey.So(client.Exists("k1"), convey.ShouldBeTrue)
+
+			//数据确实写到了服务端
+			v, _ = server.Store().Get("k1")
+			convey.So(v, convey.ShouldEqual, "v1")
+
+			convey.So(client.Delete("k1"), convey.ShouldBeNil)
+			convey.So(client.Exists("k1"), convey.ShouldBeFalse)
+		})
+
+		convey.Convey("expire", func() {
+			convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+			ok, err := client.Expire("k1", 10*time.Second)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(ok, convey.ShouldBeTrue)
+			ok, _ = client.Expire("missing", time.Second)
+			convey.So(ok, convey.ShouldBeFalse)
+
+			clock.Advance(10 * time.Second)
+			_, found := client.Get("k1")
+			convey.So(found, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("sub-second expire", func() {
+			convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+			ok, err := client.Expire("k1", 500*time.Millisecond)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(client.Exists("k1"), convey.ShouldBeTrue)
+			clock.Advance(499 * time.Millisecond)
+			convey.So(client.Exists("k1"), convey.ShouldBeTrue)
+			clock.Advance(time.Millisecond)
+			convey.So(client.Exists("k1"), convey.ShouldBeFalse)
+
+			//不足1毫秒向上取整，不会被当成0立即删除
+			convey.So(client.Set("k2", "v2"), convey.ShouldBeNil)
+			client.Expire("k2", time.Microsecond)
+			convey.So(client.Exists("k2"), convey.ShouldBeTrue)
+			clock.Advance(time.Millisecond)
+			convey.So(client.Exists("k2"), convey.ShouldBeFalse)
+		})
+
+		convey.Convey("closed client does not reconnect", func() {
+			convey.So(client.Close(), convey.ShouldBeNil)
+			convey.So(errors.Is(client.Set("k1", "v1"), ErrBackendUnavailable), convey.ShouldBeTrue)
+			convey.So(server.Store().Exists("k1"), convey.ShouldBeFalse)
+			convey.So(client.Close(), convey.ShouldBeNil)
+		})
+
+		convey.Convey("keys and scan", func() {
+			for _, k := range []string{"user:1", "user:2", "user:3", "movie:1", "user*x"} {
+				convey.So(client.Set(k, "v"), convey.ShouldBeNil)
+			}
+			keys, err := client.Keys()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"movie:1", "user*x", "user:1", "user:2", "user:3"})
+
+			var all []string
+			cursor := ""
+			for {
+				batch, next, err := client.Scan("user:", cursor, 2)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(len(batch), convey.ShouldBeLessThanOrEqualTo, 2)
+				all = append(all, batch...)
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+			sort.Strings(all)
+			convey.So(all, convey.ShouldResemble, []string{"user:1", "user:2", "user:3"})
+
+			//前缀中的glob字符需要转义
+			batch, next, err := client.Scan("user*", "", 0)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(batch, convey.ShouldResemble, []string{"user*x"})
+			convey.So(next, convey.ShouldEqual, "")
+		})
+
+		convey.Convey("abandoned scan cursors are evicted", func() {
+			client.Set("k1", "v")
+			client.Set("k2", "v")
+			var first string
+			for i := 0; i < maxSCANCursors+10; i++ {
+				reply, err := client.Do("SCAN", "0", "COUNT", "1")
+				convey.So(err, convey.ShouldBeNil)
+				if i == 0 {
+					first = reply.([]interface{})[0].(string)
+				}
+			}
+			server.mu.Lock()
+			n := len(server.cursors)
+			server.mu.Unlock()
+			convey.So(n, convey.ShouldEqual, maxSCANCursors)
+			_, err := client.Do("SCAN", first)
+			convey.So(err, convey.ShouldResemble, RESPError("ERR invalid cursor"))
+		})
+
+		convey.Convey("server errors", func() {
+			_, err := client.Do("NOPE")
+			convey.So(err, convey.ShouldHaveSameTypeAs, RESPError(""))
+			//服务端返回的错误不代表后端不可用
+			convey.So(errors.Is(err, ErrBackendUnavailable), convey.ShouldBeFalse)
+			_, err = client.Do("GET")
+			convey.So(err, convey.ShouldNotBeNil)
+			reply, err := client.Do("PING")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(reply, convey.ShouldEqual, "PONG")
+		})
+	})
+}
+
+//服务端断开后client重连
+func TestRESPClientReconnect(t *testing.T) {
+	store := NewRealClient()
+	server, client := startRESP(t, store)
+	defer client.Close()
+	addr := server.Addr()
+	if err := client.Set("k1", "v1"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	server.Close()
+
+	if err := client.Set("k1", "v2"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("Set() error = %v, want ErrBackendUnavailable when server is down", err)
+	}
+
+	server, err := StartRESPServer(addr, store)
+	if err != nil {
+		t.Skipf("cannot listen on %s again: %v", addr, err)
+	}
+	defer server.Close()
+	if v, ok := client.Get("k1"); !ok || v != "v1" {
+		t.Errorf("Get() = %v, %v, want v1, true", v, ok)
+	}
+}
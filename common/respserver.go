@@ -0,0 +1,364 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//服务端保留的SCAN游标个数，客户端可能遍历到一半就放弃，旧的游标需要淘汰
+const maxSCANCursors = 1024
+
+/*
+ * 进程内的假Redis服务，单测时监听在回环地址上，不需要外部的Redis
+ * 数据存放在一个RealClient中，支持的命令：
+ *   PING, GET, SET [EX seconds|PX milliseconds], DEL, EXISTS, EXPIRE, PEXPIRE, KEYS, SCAN [MATCH pattern] [COUNT n]
+ */
+type RESPServer struct {
+	store *RealClient
+	ln    net.Listener
+	wg    sync.WaitGroup
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	closed  bool
+	cursors map[uint64]string //SCAN游标对应的下一个key，最多保留最近的maxSCANCursors个
+	cursor  uint64
+}
+
+//在addr上启动服务，addr传"127.0.0.1:0"表示随机端口，store为nil时新建一个
+func StartRESPServer(addr string, store *RealClient) (*RESPServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		store = NewRealClient()
+	}
+	s := &RESPServer{
+		store:   store,
+		ln:      ln,
+		conns:   map[net.Conn]struct{}{},
+		cursors: map[uint64]string{},
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+//实际监听的地址
+func (s *RESPServer) Addr() string {
+	return s.ln.Addr().String()
+}
+
+//服务端的数据，单测中可以直接预置或者检查
+func (s *RESPServer) Store() *RealClient {
+	return s.store
+}
+
+//停止监听并断开所有连接
+func (s *RESPServer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.ln.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *RESPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *RESPServer) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readRESPCommand(r)
+		if err != nil {
+			return
+		}
+		s.exec(w, args)
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *RESPServer) exec(w *bufio.Writer, args []string) {
+	cmd := strings.ToUpper(args[0])
+	args = args[1:]
+	switch cmd {
+	case "PING":
+		writeSimple(w, "PONG")
+	case "GET":
+		if len(args) != 1 {
+			writeArgError(w, cmd)
+			return
+		}
+		if v, ok := s.store.Get(args[0]); ok {
+			writeBulk(w, v)
+		} else {
+			w.WriteString("$-1\r\n")
+		}
+	case "SET":
+		s.set(w, args)
+	case "DEL":
+		if len(args) == 0 {
+			writeArgError(w, cmd)
+			return
+		}
+		n := 0
+		for _, k := range args {
+			if s.store.Exists(k) {
+				s.store.Delete(k)
+				n++
+			}
+		}
+		writeInt(w, n)
+	case "EXISTS":
+		if len(args) == 0 {
+			writeArgError(w, cmd)
+			return
+		}
+		n := 0
+		for _, k := range args {
+			if s.store.Exists(k) {
+				n++
+			}
+		}
+		writeInt(w, n)
+	case "EXPIRE", "PEXPIRE":
+		if len(args) != 2 {
+			writeArgError(w, cmd)
+			return
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			writeError(w, "ERR value is not an integer or out of range")
+			return
+		}
+		unit := time.Second
+		if cmd == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		if s.store.Expire(args[0], time.Duration(n)*unit) {
+			writeInt(w, 1)
+		} else {
+			writeInt(w, 0)
+		}
+	case "KEYS":
+		if len(args) != 1 {
+			writeArgError(w, cmd)
+			return
+		}
+		keys, _ := s.store.Keys()
+		matched := make([]string, 0, len(keys))
+		for _, k := range keys {
+			if globMatch(args[0], k) {
+				matched = append(matched, k)
+			}
+		}
+		writeBulkArray(w, matched)
+	case "SCAN":
+		s.scan(w, args)
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", cmd))
+	}
+}
+
+func (s *RESPServer) set(w *bufio.Writer, args []string) {
+	if len(args) != 2 && len(args) != 4 {
+		writeArgError(w, "SET")
+		return
+	}
+	if len(args) == 2 {
+		s.store.Set(args[0], args[1])
+		writeSimple(w, "OK")
+		return
+	}
+	n, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil || n <= 0 {
+		writeError(w, "ERR invalid expire time in 'set' command")
+		return
+	}
+	var ttl time.Duration
+	switch strings.ToUpper(args[2]) {
+	case "EX":
+		ttl = time.Duration(n) * time.Second
+	case "PX":
+		ttl = time.Duration(n) * time.Millisecond
+	default:
+		writeError(w, "ERR syntax error")
+		return
+	}
+	s.store.SetWithTTL(args[0], args[1], ttl)
+	writeSimple(w, "OK")
+}
+
+//SCAN cursor [MATCH pattern] [COUNT n]
+//服务端记录每个游标对应的下一个key，遍历期间的写入不会导致已有key被重复或者跳过
+//游标的编号递增，只保留最近的maxSCANCursors个，更早的游标被淘汰后返回ERR invalid cursor
+func (s *RESPServer) scan(w *bufio.Writer, args []string) {
+	if len(args) == 0 || len(args)%2 != 1 {
+		writeArgError(w, "SCAN")
+		return
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		writeError(w, "ERR invalid cursor")
+		return
+	}
+	pattern, count := "*", 10
+	for i := 1; i < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count <= 0 {
+				writeError(w, "ERR value is not an integer or out of range")
+				return
+			}
+		default:
+			writeError(w, "ERR syntax error")
+			return
+		}
+	}
+
+	from := ""
+	if id != 0 {
+		s.mu.Lock()
+		k, ok := s.cursors[id]
+		delete(s.cursors, id)
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, "ERR invalid cursor")
+			return
+		}
+		from = k
+	}
+
+	//和Redis一样，COUNT限制的是遍历的key数，MATCH在遍历之后过滤，所以一批返回的结果可能少于COUNT
+	batch, next, _ := s.store.Scan("", from, count)
+	matched := make([]string, 0, len(batch))
+	for _, k := range batch {
+		if globMatch(pattern, k) {
+			matched = append(matched, k)
+		}
+	}
+
+	var nextID uint64
+	if next != "" {
+		s.mu.Lock()
+		s.cursor++
+		nextID = s.cursor
+		s.cursors[nextID] = next
+		if nextID > maxSCANCursors {
+			delete(s.cursors, nextID-maxSCANCursors)
+		}
+		s.mu.Unlock()
+	}
+	w.WriteString("*2\r\n")
+	writeBulk(w, strconv.FormatUint(nextID, 10))
+	writeBulkArray(w, matched)
+}
+
+func writeSimple(w *bufio.Writer, s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+func writeError(w *bufio.Writer, s string) {
+	w.WriteString("-" + s + "\r\n")
+}
+
+func writeArgError(w *bufio.Writer, cmd string) {
+	writeError(w, fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+}
+
+func writeInt(w *bufio.Writer, n int) {
+	fmt.Fprintf(w, ":%d\r\n", n)
+}
+
+func writeBulk(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func writeBulkArray(w *bufio.Writer, ss []string) {
+	fmt.Fprintf(w, "*%d\r\n", len(ss))
+	for _, s := range ss {
+		writeBulk(w, s)
+	}
+}
+
+//Redis风格的glob匹配，支持*、?和\转义，不支持[]
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,271 @@
+package common
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+//熔断器打开期间直接返回的错误，errors.Is(ErrCircuitOpen, ErrBackendUnavailable)为true
+var ErrCircuitOpen error = &circuitOpenError{}
+
+type circuitOpenError struct{}
+
+func (*circuitOpenError) Error() string {
+	return "storage: circuit breaker is open"
+}
+
+func (*circuitOpenError) Is(target error) bool {
+	return target == ErrBackendUnavailable
+}
+
+//重试策略
+type RetryPolicy struct {
+	MaxAttempts int           //总的尝试次数，包括第一次，<=1表示不重试
+	BaseDelay   time.Duration //第一次重试之前的等待时间
+	MaxDelay    time.Duration //等待时间的上限，<=0表示不限
+	Multiplier  float64       //每次重试等待时间的倍数，<=1时按2处理
+	Jitter      float64       //随机抖动比例(0~1)，实际等待时间在[d*(1-Jitter), d]之间
+}
+
+//熔断策略
+//连续失败FailureThreshold次后打开，打开期间所有请求直接返回ErrCircuitOpen
+//OpenTimeout之后进入半开状态，放行HalfOpenProbes个探测请求，全部成功则关闭，任何一个失败则重新打开
+type BreakerPolicy struct {
+	FailureThreshold int //<=0表示不启用熔断
+	OpenTimeout      time.Duration
+	HalfOpenProbes   int //<=0时按1处理
+}
+
+//RetryClient的配置
+type RetryConfig struct {
+	Retry   RetryPolicy
+	Breaker BreakerPolicy
+	Clock   Clock               //熔断器计时用，默认SystemClock
+	Sleep   func(time.Duration) //重试之间的等待，默认time.Sleep，单测中可以换成FakeClock.Sleep
+	Rand    *rand.Rand          //抖动用的随机源，默认按当前时间初始化
+	//哪些错误需要重试并计入熔断，默认为IsRetryable
+	//其他错误(比如ErrNotFound)说明后端正常工作，直接返回，对熔断器来说等同于成功
+	Retryable func(error) bool
+}
+
+//RetryConfig.Retryable的默认值，只有后端不可用(ErrBackendUnavailable)才重试
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrBackendUnavailable)
+}
+
+//熔断器的状态
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+//给任意StorageClient加上重试和熔断
+//只有返回error的方法(Set、Delete、Keys、Scan)会重试并计入熔断，Get和Exists无法感知失败，直接透传
+//默认只有ErrBackendUnavailable会重试，见RetryConfig.Retryable
+type RetryClient struct {
+	c   StorageClient
+	cfg RetryConfig
+
+	mu        sync.Mutex
+	rand      *rand.Rand
+	state     BreakerState
+	failures  int       //关闭状态下连续失败的次数
+	openedAt  time.Time //最近一次打开的时间
+	probes    int       //半开状态下已经放行的探测请求数
+	successes int       //半开状态下成功的探测请求数
+}
+
+func NewRetryClient(c StorageClient, cfg RetryConfig) *RetryClient {
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock
+	}
+	if cfg.Sleep == nil {
+		cfg.Sleep = time.Sleep
+	}
+	if cfg.Retryable == nil {
+		cfg.Retryable = IsRetryable
+	}
+	if cfg.Retry.Multiplier <= 1 {
+		cfg.Retry.Multiplier = 2
+	}
+	if cfg.Breaker.HalfOpenProbes <= 0 {
+		cfg.Breaker.HalfOpenProbes = 1
+	}
+	r := cfg.Rand
+	if r == nil {
+		r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return &RetryClient{c: c, cfg: cfg, rand: r}
+}
+
+func (r *RetryClient) Get(k string) (string, bool) {
+	return r.c.Get(k)
+}
+
+func (r *RetryClient) Set(k, v string) error {
+	return r.do(func() error {
+		return r.c.Set(k, v)
+	})
+}
+
+func (r *RetryClient) Delete(k string) error {
+	return r.do(func() error {
+		return r.c.Delete(k)
+	})
+}
+
+func (r *RetryClient) Exists(k string) bool {
+	return r.c.Exists(k)
+}
+
+func (r *RetryClient) Keys() ([]string, error) {
+	var keys []string
+	err := r.do(func() error {
+		var err error
+		keys, err = r.c.Keys()
+		return err
+	})
+	return keys, err
+}
+
+func (r *RetryClient) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	var keys []string
+	var next string
+	err := r.do(func() error {
+		var err error
+		keys, next, err = r.c.Scan(prefix, cursor, limit)
+		return err
+	})
+	return keys, next, err
+}
+
+//熔断器当前的状态
+func (r *RetryClient) State() BreakerState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refresh()
+	return r.state
+}
+
+func (r *RetryClient) do(f func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if !r.allow() {
+			return ErrCircuitOpen
+		}
+		err = f()
+		if err != nil && !r.cfg.Retryable(err) {
+			r.record(nil)
+			return err
+		}
+		r.record(err)
+		if err == nil || attempt >= r.cfg.Retry.MaxAttempts {
+			return err
+		}
+		r.cfg.Sleep(r.backoff(attempt))
+	}
+}
+
+//第attempt次失败之后的等待时间
+func (r *RetryClient) backoff(attempt int) time.Duration {
+	p := r.cfg.Retry
+	d := float64(p.BaseDelay)
+	for i := 1; i < attempt; i++ {
+		d *= p.Multiplier
+		if p.MaxDelay > 0 && d >= float64(p.MaxDelay) {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		r.mu.Lock()
+		d -= d * p.Jitter * r.rand.Float64()
+		r.mu.Unlock()
+	}
+	return time.Duration(d)
+}
+
+//打开状态超时后转为半开，调用方需要持有r.mu
+func (r *RetryClient) refresh() {
+	if r.state == BreakerOpen && !r.cfg.Clock.Now().Before(r.openedAt.Add(r.cfg.Breaker.OpenTimeout)) {
+		r.state = BreakerHalfOpen
+		r.probes = 0
+		r.successes = 0
+	}
+}
+
+//是否放行一次请求
+func (r *RetryClient) allow() bool {
+	if r.cfg.Breaker.FailureThreshold <= 0 {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refresh()
+	switch r.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if r.probes >= r.cfg.Breaker.HalfOpenProbes {
+			return false
+		}
+		r.probes++
+	}
+	return true
+}
+
+//记录一次请求的结果
+func (r *RetryClient) record(err error) {
+	if r.cfg.Breaker.FailureThreshold <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch r.state {
+	case BreakerClosed:
+		if err == nil {
+			r.failures = 0
+			return
+		}
+		r.failures++
+		if r.failures >= r.cfg.Breaker.FailureThreshold {
+			r.open()
+		}
+	case BreakerHalfOpen:
+		if err != nil {
+			r.open()
+			return
+		}
+		r.successes++
+		if r.successes >= r.cfg.Breaker.HalfOpenProbes {
+			r.state = BreakerClosed
+			r.failures = 0
+		}
+	}
+}
+
+//调用方需要持有r.mu
+func (r *RetryClient) open() {
+	r.state = BreakerOpen
+	r.openedAt = r.cfg.Clock.Now()
+	r.failures = 0
+}
@@ -0,0 +1,203 @@
+package common
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+var errScripted error = &UnavailableError{Backend: "scripted", Err: errors.New("scripted failure")}
+
+//按脚本返回结果的client，script[i]为第i次Set的结果，脚本用完后一直成功
+type scriptedClient struct {
+	StorageClient
+	mu     sync.Mutex
+	script []error
+	calls  int
+}
+
+func (c *scriptedClient) Set(k, v string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	if len(c.script) > 0 {
+		err := c.script[0]
+		c.script = c.script[1:]
+		if err != nil {
+			return err
+		}
+	}
+	return c.StorageClient.Set(k, v)
+}
+
+func failures(n int) []error {
+	script := make([]error, n)
+	for i := range script {
+		script[i] = errScripted
+	}
+	return script
+}
+
+//记录每次sleep的时长，同时拨动时钟
+type sleepRecorder struct {
+	clock  *FakeClock
+	delays []time.Duration
+}
+
+func (s *sleepRecorder) Sleep(d time.Duration) {
+	s.delays = append(s.delays, d)
+	s.clock.Sleep(d)
+}
+
+func TestRetryClient(t *testing.T) {
+	convey.Convey("TestRetryClient", t, func() {
+		clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		sleeper := &sleepRecorder{clock: clock}
+		inner := &scriptedClient{StorageClient: NewRealClient()}
+		cfg := RetryConfig{
+			Retry: RetryPolicy{MaxAttempts: 4, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond},
+			Clock: clock,
+			Sleep: sleeper.Sleep,
+		}
+
+		convey.Convey("succeed after retries", func() {
+			inner.script = failures(3)
+			client := NewRetryClient(inner, cfg)
+			convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+			convey.So(inner.calls, convey.ShouldEqual, 4)
+			//指数退避，并且不超过MaxDelay
+			convey.So(sleeper.delays, convey.ShouldResemble, []time.Duration{
+				100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond,
+			})
+			v, _ := client.Get("k1")
+			convey.So(v, convey.ShouldEqual, "v1")
+		})
+
+		convey.Convey("give up after MaxAttempts", func() {
+			inner.script = failures(10)
+			client := NewRetryClient(inner, cfg)
+			convey.So(client.Set("k1", "v1"), convey.ShouldEqual, errScripted)
+			convey.So(inner.calls, convey.ShouldEqual, 4)
+			convey.So(len(sleeper.delays), convey.ShouldEqual, 3)
+		})
+
+		convey.Convey("other errors are not retried", func() {
+			notFound := &NotFoundError{Key: "k1"}
+			inner.script = []error{notFound}
+			client := NewRetryClient(inner, cfg)
+			convey.So(client.Set("k1", "v1"), convey.ShouldEqual, notFound)
+			convey.So(inner.calls, convey.ShouldEqual, 1)
+			convey.So(sleeper.delays, convey.ShouldBeEmpty)
+
+			//自定义哪些错误需要重试
+			cfg.Retryable = func(err error) bool { return err == notFound }
+			inner.script = []error{notFound, errScripted}
+			client = NewRetryClient(inner, cfg)
+			convey.So(client.Set("k1", "v1"), convey.ShouldEqual, errScripted)
+			convey.So(inner.calls, convey.ShouldEqual, 3)
+		})
+
+		convey.Convey("jitter", func() {
+			inner.script = failures(3)
+			cfg.Retry.Jitter = 0.5
+			cfg.Rand = rand.New(rand.NewSource(1))
+			client := NewRetryClient(inner, cfg)
+			convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+			want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}
+			for i, d := range sleeper.delays {
+				convey.So(d, convey.ShouldBeLessThanOrEqualTo, want[i])
+				convey.So(d, convey.ShouldBeGreaterThanOrEqualTo, want[i]/2)
+			}
+
+			//同样的种子得到同样的等待时间
+			first := sleeper.delays
+			sleeper.delays = nil
+			inner.script = failures(3)
+			cfg.Rand = rand.New(rand.NewSource(1))
+			NewRetryClient(inner, cfg).Set("k1", "v1")
+			convey.So(sleeper.delays, convey.ShouldResemble, first)
+		})
+	})
+}
+
+func TestRetryClientBreaker(t *testing.T) {
+	convey.Convey("TestRetryClientBreaker", t, func() {
+		clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		inner := &scriptedClient{StorageClient: NewRealClient()}
+		client := NewRetryClient(inner, RetryConfig{
+			Retry:   RetryPolicy{MaxAttempts: 1},
+			Breaker: BreakerPolicy{FailureThreshold: 3, OpenTimeout: time.Minute, HalfOpenProbes: 2},
+			Clock:   clock,
+			Sleep:   clock.Sleep,
+		})
+
+		convey.Convey("open after consecutive failures", func() {
+			inner.script = []error{errScripted, errScripted, nil, errScripted, errScripted, errScripted}
+			for i := 0; i < 6; i++ {
+				client.Set("k1", "v1")
+			}
+			convey.So(client.State(), convey.ShouldEqual, BreakerOpen)
+
+			//打开期间不再访问后端
+			err := client.Set("k1", "v1")
+			convey.So(err, convey.ShouldEqual, ErrCircuitOpen)
+			convey.So(errors.Is(err, ErrBackendUnavailable), convey.ShouldBeTrue)
+			convey.So(inner.calls, convey.ShouldEqual, 6)
+
+			convey.Convey("half open then close", func() {
+				clock.Advance(time.Minute)
+				convey.So(client.State(), convey.ShouldEqual, BreakerHalfOpen)
+				convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+				convey.So(client.State(), convey.ShouldEqual, BreakerHalfOpen)
+				convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+				convey.So(client.State(), convey.ShouldEqual, BreakerClosed)
+			})
+
+			convey.Convey("half open then open again", func() {
+				clock.Advance(time.Minute)
+				inner.script = failures(1)
+				convey.So(client.Set("k1", "v1"), convey.ShouldEqual, errScripted)
+				convey.So(client.State(), convey.ShouldEqual, BreakerOpen)
+				clock.Advance(time.Second)
+				convey.So(client.Set("k1", "v1"), convey.ShouldEqual, ErrCircuitOpen)
+			})
+		})
+
+		convey.Convey("retries stop when breaker opens", func() {
+			client := NewRetryClient(inner, RetryConfig{
+				Retry:   RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second},
+				Breaker: BreakerPolicy{FailureThreshold: 3, OpenTimeout: time.Minute},
+				Clock:   clock,
+				Sleep:   clock.Sleep,
+			})
+			inner.script = failures(10)
+			convey.So(client.Set("k1", "v1"), convey.ShouldEqual, ErrCircuitOpen)
+			convey.So(inner.calls, convey.ShouldEqual, 3)
+		})
+
+		convey.Convey("other errors do not count as failures", func() {
+			notFound := &NotFoundError{Key: "k1"}
+			inner.script = []error{errScripted, errScripted, notFound, errScripted, errScripted}
+			for i := 0; i < 5; i++ {
+				client.Set("k1", "v1")
+			}
+			convey.So(client.State(), convey.ShouldEqual, BreakerClosed)
+			convey.So(inner.calls, convey.ShouldEqual, 5)
+		})
+
+		convey.Convey("half open limits probes", func() {
+			inner.script = failures(3)
+			for i := 0; i < 3; i++ {
+				client.Set("k1", "v1")
+			}
+			clock.Advance(time.Minute)
+			convey.So(client.allow(), convey.ShouldBeTrue)
+			convey.So(client.allow(), convey.ShouldBeTrue)
+			convey.So(client.allow(), convey.ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package common
+
+import (
+	"strings"
+	"sync"
+)
+
+//ShardedConfig.Shards不设置时的分片个数
+const DefaultShards = 32
+
+//ShardedClient的配置
+type ShardedConfig struct {
+	Shards int //分片个数，<=0表示使用DefaultShards
+}
+
+//按key的hash分片的内存存储，每个分片有独立的读写锁
+//大量goroutine并发访问不同的key时，锁竞争比RealClient的单个锁小得多
+//单个key的读写是线性一致的，Keys、Scan逐个分片加锁，不是全局快照，但不会重复或者跳过遍历期间一直存在的key
+type ShardedClient struct {
+	shards []*shard
+}
+
+type shard struct {
+	mu   sync.RWMutex
+	data map[string]string
+	//填充到cache line大小，避免相邻分片的锁互相影响
+	_ [64]byte
+}
+
+func NewShardedStorageClient(cfg ShardedConfig) *ShardedClient {
+	n := cfg.Shards
+	if n <= 0 {
+		n = DefaultShards
+	}
+	c := &ShardedClient{shards: make([]*shard, n)}
+	for i := range c.shards {
+		c.shards[i] = &shard{data: map[string]string{}}
+	}
+	return c
+}
+
+//32位fnv-1a，直接在string上计算，避免hash/fnv转换[]byte带来的内存分配
+func (c *ShardedClient) shardFor(k string) *shard {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	h := uint32(offset32)
+	for i := 0; i < len(k); i++ {
+		h ^= uint32(k[i])
+		h *= prime32
+	}
+	return c.shards[h%uint32(len(c.shards))]
+}
+
+func (c *ShardedClient) Get(k string) (string, bool) {
+	s := c.shardFor(k)
+	s.mu.RLock()
+	v, ok := s.data[k]
+	s.mu.RUnlock()
+	return v, ok
+}
+
+func (c *ShardedClient) Set(k, v string) error {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	s.data[k] = v
+	s.mu.Unlock()
+	return nil
+}
+
+func (c *ShardedClient) Delete(k string) error {
+	s := c.shardFor(k)
+	s.mu.Lock()
+	delete(s.data, k)
+	s.mu.Unlock()
+	return nil
+}
+
+func (c *ShardedClient) Exists(k string) bool {
+	_, ok := c.Get(k)
+	return ok
+}
+
+func (c *ShardedClient) Keys() ([]string, error) {
+	keys, _, err := c.Scan("", "", 0)
+	return keys, err
+}
+
+//收集所有分片中的候选key后统一排序，cursor的含义和RealClient相同
+func (c *ShardedClient) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	var keys []string
+	for _, s := range c.shards {
+		s.mu.RLock()
+		for k := range s.data {
+			if k >= cursor && strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		s.mu.RUnlock()
+	}
+
+	keys, next := scanPage(keys, limit)
+	return keys, next, nil
+}
+
+//所有分片的key总数
+func (c *ShardedClient) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.RLock()
+		n += len(s.data)
+		s.mu.RUnlock()
+	}
+	return n
+}
@@ -0,0 +1,152 @@
+package common
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestShardedClient(t *testing.T) {
+	convey.Convey("TestShardedClient", t, func() {
+		convey.Convey("default shards", func() {
+			client := NewShardedStorageClient(ShardedConfig{})
+			convey.So(len(client.shards), convey.ShouldEqual, DefaultShards)
+			client = NewShardedStorageClient(ShardedConfig{Shards: 3})
+			convey.So(len(client.shards), convey.ShouldEqual, 3)
+		})
+
+		convey.Convey("same hash as hash/fnv", func() {
+			client := NewShardedStorageClient(ShardedConfig{Shards: 7})
+			for _, k := range []string{"", "a", "movie:1", "电影"} {
+				h := fnv.New32a()
+				h.Write([]byte(k))
+				convey.So(client.shardFor(k), convey.ShouldEqual, client.shards[h.Sum32()%7])
+			}
+		})
+
+		convey.Convey("keys spread over shards", func() {
+			client := NewShardedStorageClient(ShardedConfig{Shards: 8})
+			for i := 0; i < 800; i++ {
+				client.Set("k"+strconv.Itoa(i), "v")
+			}
+			convey.So(client.Len(), convey.ShouldEqual, 800)
+			for _, s := range client.shards {
+				convey.So(len(s.data), convey.ShouldBeBetween, 50, 150)
+			}
+		})
+
+		convey.Convey("scan merges shards in order", func() {
+			client := NewShardedStorageClient(ShardedConfig{Shards: 4})
+			for _, k := range []string{"b2", "a1", "b1", "c1", "b3"} {
+				client.Set(k, "v")
+			}
+			keys, _ := client.Keys()
+			convey.So(keys, convey.ShouldResemble, []string{"a1", "b1", "b2", "b3", "c1"})
+
+			keys, next, _ := client.Scan("b", "", 2)
+			convey.So(keys, convey.ShouldResemble, []string{"b1", "b2"})
+			keys, next, _ = client.Scan("b", next, 2)
+			convey.So(keys, convey.ShouldResemble, []string{"b3"})
+			convey.So(next, convey.ShouldEqual, "")
+		})
+
+		convey.Convey("delete", func() {
+			client := NewShardedStorageClient(ShardedConfig{})
+			client.Set("k", "v")
+			convey.So(client.Delete("k"), convey.ShouldBeNil)
+			convey.So(client.Delete("k"), convey.ShouldBeNil)
+			convey.So(client.Exists("k"), convey.ShouldBeFalse)
+			convey.So(client.Len(), convey.ShouldEqual, 0)
+		})
+	})
+}
+
+func TestShardedClientStress(t *testing.T) {
+	client := NewShardedStorageClient(ShardedConfig{Shards: 4})
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				k := strconv.Itoa(g*1000 + i%100)
+				client.Set(k, strconv.Itoa(i))
+				if _, ok := client.Get(k); !ok {
+					t.Errorf("Get(%q) not found after Set", k)
+					return
+				}
+				if i%10 == 0 {
+					client.Scan("", "", 10)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if n := client.Len(); n != 16*100 {
+		t.Errorf("Len() = %d, want %d", n, 16*100)
+	}
+}
+
+/*
+ * 对比RealClient(单个读写锁)和ShardedClient在不同并发度、不同读写比例下的吞吐
+ *   go test -run xxx -bench 'Store' -benchmem ./common/
+ * 每个子测试名为store/p/reads，例如sharded-32/p16/r90表示32个分片、GOMAXPROCS*16个goroutine、90%读
+ */
+const benchKeys = 1 << 14
+
+func BenchmarkStore(b *testing.B) {
+	stores := []struct {
+		name string
+		new  func() StorageClient
+	}{
+		{"real", func() StorageClient { return NewRealClient() }},
+		{"sharded-8", func() StorageClient { return NewShardedStorageClient(ShardedConfig{Shards: 8}) }},
+		{"sharded-32", func() StorageClient { return NewShardedStorageClient(ShardedConfig{Shards: 32}) }},
+		{"sharded-256", func() StorageClient { return NewShardedStorageClient(ShardedConfig{Shards: 256}) }},
+	}
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = "movie:" + strconv.Itoa(i)
+	}
+
+	for _, store := range stores {
+		for _, p := range []int{1, 4, 16} {
+			for _, reads := range []int{50, 90, 99} {
+				name := fmt.Sprintf("%s/p%d/r%d", store.name, p, reads)
+				b.Run(name, func(b *testing.B) {
+					client := store.new()
+					for _, k := range keys {
+						client.Set(k, "v")
+					}
+					benchmarkMix(b, client, keys, p, reads)
+				})
+			}
+		}
+	}
+}
+
+//每个goroutine用自己的随机数生成器，避免rand全局锁影响结果
+func benchmarkMix(b *testing.B, client StorageClient, keys []string, parallelism, reads int) {
+	var seed int64
+	b.SetParallelism(parallelism)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+		for pb.Next() {
+			k := keys[r.Intn(len(keys))]
+			if r.Intn(100) < reads {
+				client.Get(k)
+			} else {
+				client.Set(k, "v")
+			}
+		}
+	})
+}
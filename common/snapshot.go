@@ -0,0 +1,183 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+//可以整体导出、导入数据的存储
+//没有实现该接口的StorageClient通过Keys逐个读写，效果相同
+type Snapshotter interface {
+	//当前所有数据的拷贝
+	Snapshot() (map[string]string, error)
+	//用data替换当前所有数据
+	Restore(data map[string]string) error
+}
+
+//快照文件的版本
+const SnapshotVersion = 1
+
+//快照文件的格式
+type snapshotFile struct {
+	Version int               `json:"version"`
+	Data    map[string]string `json:"data"`
+}
+
+//导出c中的所有数据，过期时间不会被保存
+func TakeSnapshot(c StorageClient) (map[string]string, error) {
+	if s, ok := c.(Snapshotter); ok {
+		return s.Snapshot()
+	}
+	keys, err := c.Keys()
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]string, len(keys))
+	for _, k := range keys {
+		//遍历期间被删除的key直接跳过
+		if v, ok := c.Get(k); ok {
+			data[k] = v
+		}
+	}
+	return data, nil
+}
+
+//用data替换c中的所有数据
+func RestoreSnapshot(c StorageClient, data map[string]string) error {
+	if s, ok := c.(Snapshotter); ok {
+		return s.Restore(data)
+	}
+	keys, err := c.Keys()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if _, ok := data[k]; ok {
+			continue
+		}
+		if err := c.Delete(k); err != nil {
+			return err
+		}
+	}
+	for k, v := range data {
+		if err := c.Set(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//把c中的数据以JSON格式写到w
+func WriteSnapshot(c StorageClient, w io.Writer) error {
+	data, err := TakeSnapshot(c)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(snapshotFile{Version: SnapshotVersion, Data: data})
+}
+
+//从r读取JSON格式的快照，替换c中的数据
+func ReadSnapshot(c StorageClient, r io.Reader) error {
+	var f snapshotFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+	if f.Version != SnapshotVersion {
+		return fmt.Errorf("snapshot: unsupported version %d", f.Version)
+	}
+	if f.Data == nil {
+		f.Data = map[string]string{}
+	}
+	return RestoreSnapshot(c, f.Data)
+}
+
+//把快照保存到path，先写临时文件再改名，不会留下写了一半的文件
+//改名前先Sync临时文件，改名后Sync所在目录，保证掉电后path要么是旧快照要么是完整的新快照
+func SaveSnapshot(c StorageClient, path string) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := WriteSnapshot(c, tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+//让目录项的修改(比如Rename)落盘，Windows不支持对目录Sync，直接跳过
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+//从path加载快照
+func LoadSnapshot(c StorageClient, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ReadSnapshot(c, f)
+}
+
+//已过期的key不会被导出
+func (m *RealClient) Snapshot() (map[string]string, error) {
+	now := m.now()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data := make(map[string]string, len(m.data))
+	for k, e := range m.data {
+		if !e.expired(now) {
+			data[k] = e.value
+		}
+	}
+	return data, nil
+}
+
+//恢复后的数据都不会过期，订阅方会收到相应的删除和写入事件
+func (m *RealClient) Restore(data map[string]string) error {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, e := range m.data {
+		if _, ok := data[k]; ok {
+			continue
+		}
+		delete(m.data, k)
+		if !e.expired(now) {
+			m.notifyRemove(EventDelete, k, e)
+		}
+	}
+	for k, v := range data {
+		m.store(k, entry{value: v}, now)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestSnapshot(t *testing.T) {
+	convey.Convey("TestSnapshot", t, func() {
+		dir, err := ioutil.TempDir("", "snapshot")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "snapshot.json")
+
+		convey.Convey("save and load", func() {
+			clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+			src := NewRealClient(WithClock(clock))
+			src.Set("k1", "v1")
+			src.Set("k2", "")
+			src.SetWithTTL("tmp", "v", time.Second)
+			clock.Advance(time.Second)
+			convey.So(SaveSnapshot(src, path), convey.ShouldBeNil)
+
+			dst := NewRealClient()
+			dst.Set("stale", "x")
+			convey.So(LoadSnapshot(dst, path), convey.ShouldBeNil)
+			data, _ := dst.Snapshot()
+			convey.So(data, convey.ShouldResemble, map[string]string{"k1": "v1", "k2": ""})
+		})
+
+		convey.Convey("no temp file left behind", func() {
+			src := NewRealClient()
+			src.Set("k1", "v1")
+			convey.So(SaveSnapshot(src, path), convey.ShouldBeNil)
+			src.Set("k1", "v2")
+			convey.So(SaveSnapshot(src, path), convey.ShouldBeNil)
+			files, _ := ioutil.ReadDir(dir)
+			convey.So(len(files), convey.ShouldEqual, 1)
+			convey.So(files[0].Name(), convey.ShouldEqual, "snapshot.json")
+
+			//目录不存在时返回错误
+			convey.So(SaveSnapshot(src, filepath.Join(dir, "missing", "snapshot.json")), convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("client without Snapshotter", func() {
+			src := NewLRUStorageClient(LRUConfig{})
+			src.Set("k1", "v1")
+			src.Set("k2", "v2")
+			convey.So(SaveSnapshot(src, path), convey.ShouldBeNil)
+
+			dst := NewLRUStorageClient(LRUConfig{})
+			dst.Set("stale", "x")
+			dst.Set("k1", "old")
+			convey.So(LoadSnapshot(dst, path), convey.ShouldBeNil)
+			keys, _ := dst.Keys()
+			convey.So(keys, convey.ShouldResemble, []string{"k1", "k2"})
+			v, _ := dst.Get("k1")
+			convey.So(v, convey.ShouldEqual, "v1")
+		})
+
+		convey.Convey("load fixture", func() {
+			client := NewRealClient()
+			convey.So(LoadSnapshot(client, "testdata/snapshot.json"), convey.ShouldBeNil)
+			v, ok := client.Get("key1")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(v, convey.ShouldEqual, "Hello world")
+			keys, _ := client.Keys()
+			convey.So(len(keys), convey.ShouldEqual, 3)
+		})
+
+		convey.Convey("bad input", func() {
+			client := NewRealClient()
+			client.Set("k1", "v1")
+			convey.So(ReadSnapshot(client, bytes.NewBufferString(`{"version":1,"data":`)), convey.ShouldNotBeNil)
+			convey.So(ReadSnapshot(client, bytes.NewBufferString(`{"version":2,"data":{}}`)), convey.ShouldNotBeNil)
+			convey.So(LoadSnapshot(client, filepath.Join(dir, "missing.json")), convey.ShouldNotBeNil)
+			//失败时不改动已有数据
+			v, _ := client.Get("k1")
+			convey.So(v, convey.ShouldEqual, "v1")
+		})
+
+		convey.Convey("restore notifies watchers", func() {
+			client := NewRealClient()
+			client.Set("k1", "v1")
+			sub := client.WatchPrefix("")
+			defer sub.Cancel()
+			convey.So(client.Restore(map[string]string{"k2": "v2"}), convey.ShouldBeNil)
+
+			events := recvEvents(t, sub, 2)
+			convey.So(events[0].Type, convey.ShouldEqual, EventDelete)
+			convey.So(events[0].Key, convey.ShouldEqual, "k1")
+			convey.So(events[1].Type, convey.ShouldEqual, EventSet)
+			convey.So(events[1].Key, convey.ShouldEqual, "k2")
+		})
+	})
+}
@@ -2,43 +2,361 @@ package common
 
 import (
 	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 //接口定义，模拟某种存储的操作，稍后通过gomock进行替身变换
 type StorageClient interface {
 	Set(k, v string) error
 	Get(k string) (string, bool)
+	//删除k，k不存在不算错误
+	Delete(k string) error
+	Exists(k string) bool
+	//所有key，按字典序排列
+	Keys() ([]string, error)
+	//按前缀分批遍历key，每批最多limit个（limit<=0表示不限）
+	//cursor传空串表示从头开始，返回的next为空串表示遍历结束，否则作为下一次调用的cursor
+	Scan(prefix, cursor string, limit int) (keys []string, next string, err error)
 }
 
-var DataMap map[string]string
+//支持过期时间的存储
+type TTLStorageClient interface {
+	StorageClient
+	//写入k，ttl之后过期
+	SetWithTTL(k, v string, ttl time.Duration) error
+	//k的剩余存活时间，k不存在返回false，k永不过期返回NoExpiry
+	TTL(k string) (time.Duration, bool)
+}
+
+//支持批量和原子操作的存储
+type AtomicStorageClient interface {
+	StorageClient
+	//批量读取，不存在的key不出现在结果中
+	MGet(keys ...string) (map[string]string, error)
+	//批量写入，要么全部写入要么全部不写入
+	MSet(kvs map[string]string) error
+	//k存在并且当前值等于old时替换成new，返回是否替换
+	CompareAndSwap(k, old, new string) (bool, error)
+	//k存在时返回当前值和true，否则写入def并返回def和false，类似sync.Map的LoadOrStore
+	GetOrSet(k, def string) (actual string, loaded bool, err error)
+}
+
+//TTL对于永不过期的key的返回值
+const NoExpiry time.Duration = -1
+
+type entry struct {
+	value    string
+	expireAt time.Time //零值表示永不过期
+}
 
-func init () {
-	DataMap = map[string]string{}
+func (e entry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
 }
 
 //具体实现
+//每个client独占一份数据，由读写锁保护，多个goroutine并发调用是安全的
+//过期的key在访问时惰性删除，另外可以通过WithEvictInterval开启后台定期清理
+//实现了Watcher，可以订阅变更
+//零值可以直接使用
 type RealClient struct {
+	mu    sync.RWMutex
+	data  map[string]entry
+	clock Clock
+
+	watchers    map[*Subscription]struct{}
+	watchBuffer int
+	watchClosed bool
+
+	evictInterval time.Duration
+	stop          chan struct{}
+	stopOnce      sync.Once
+}
+
+//RealClient的可选配置
+type Option func(*RealClient)
+
+//注入时钟，不设置则使用SystemClock
+func WithClock(c Clock) Option {
+	return func(m *RealClient) {
+		m.clock = c
+	}
+}
+
+//开启后台定期清理过期key，d<=0表示不开启
+//开启后需要调用Close来结束后台goroutine
+func WithEvictInterval(d time.Duration) Option {
+	return func(m *RealClient) {
+		m.evictInterval = d
+	}
 }
 
 func NewStorageClient() StorageClient {
-	return &RealClient{}
+	return NewRealClient()
+}
+
+//用已有数据初始化client
+//store中的数据会被拷贝一份，之后调用方再修改store不会影响client
+func NewStorageClientWithStore(store map[string]string) StorageClient {
+	m := NewRealClient()
+	for k, v := range store {
+		m.data[k] = entry{value: v}
+	}
+	return m
+}
+
+func NewRealClient(opts ...Option) *RealClient {
+	m := &RealClient{data: map[string]entry{}}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.evictInterval > 0 {
+		m.stop = make(chan struct{})
+		go m.evictLoop()
+	}
+	return m
 }
 
-func (m *RealClient)Get(k string) (string, bool) {
-	if DataMap == nil {
+func (m *RealClient) now() time.Time {
+	if m.clock == nil {
+		return SystemClock.Now()
+	}
+	return m.clock.Now()
+}
+
+func (m *RealClient) Get(k string) (string, bool) {
+	m.mu.RLock()
+	e, ok := m.data[k]
+	m.mu.RUnlock()
+	if !ok {
 		return "", false
 	}
-	if v, ok := DataMap[k]; ok {
-		return v, true
-	} else {
+	if e.expired(m.now()) {
+		m.expire(k)
 		return "", false
 	}
+	return e.value, true
+}
+
+func (m *RealClient) Set(k, v string) error {
+	m.set(k, entry{value: v})
+	return nil
 }
 
-func (m *RealClient)Set(k, v string) error {
-	if DataMap == nil {
-		return errors.New("DataMap is nil")
+func (m *RealClient) SetWithTTL(k, v string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
 	}
-	DataMap[k] = v
+	m.set(k, entry{value: v, expireAt: m.now().Add(ttl)})
 	return nil
-}
\ No newline at end of file
+}
+
+//重新设置已有key的过期时间，ttl<=0时直接删除，k不存在返回false
+func (m *RealClient) Expire(k string, ttl time.Duration) bool {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.data[k]
+	if !ok || e.expired(now) {
+		return false
+	}
+	if ttl <= 0 {
+		delete(m.data, k)
+		m.notifyRemove(EventDelete, k, e)
+		return true
+	}
+	e.expireAt = now.Add(ttl)
+	m.data[k] = e
+	return true
+}
+
+func (m *RealClient) TTL(k string) (time.Duration, bool) {
+	m.mu.RLock()
+	e, ok := m.data[k]
+	m.mu.RUnlock()
+	if !ok {
+		return 0, false
+	}
+	now := m.now()
+	if e.expired(now) {
+		m.expire(k)
+		return 0, false
+	}
+	if e.expireAt.IsZero() {
+		return NoExpiry, true
+	}
+	return e.expireAt.Sub(now), true
+}
+
+func (m *RealClient) Delete(k string) error {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.data[k]
+	if !ok {
+		return nil
+	}
+	delete(m.data, k)
+	if !e.expired(now) {
+		m.notifyRemove(EventDelete, k, e)
+	}
+	return nil
+}
+
+func (m *RealClient) Exists(k string) bool {
+	_, ok := m.Get(k)
+	return ok
+}
+
+func (m *RealClient) Keys() ([]string, error) {
+	keys, _, err := m.Scan("", "", 0)
+	return keys, err
+}
+
+//cursor为上一批最后一个key在字典序上的下一个字符串（末尾补\x00），本批从不小于cursor的key开始
+//遍历期间有写入也不会重复或者跳过已有的key
+func (m *RealClient) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	now := m.now()
+	m.mu.RLock()
+	keys := make([]string, 0, len(m.data))
+	for k, e := range m.data {
+		if k >= cursor && strings.HasPrefix(k, prefix) && !e.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	m.mu.RUnlock()
+
+	keys, next := scanPage(keys, limit)
+	return keys, next, nil
+}
+
+//keys为不小于cursor的所有候选key，排序后取前limit个，并算出下一批的cursor
+func scanPage(keys []string, limit int) ([]string, string) {
+	sort.Strings(keys)
+	if limit <= 0 || len(keys) <= limit {
+		return keys, ""
+	}
+	keys = keys[:limit]
+	return keys, keys[limit-1] + "\x00"
+}
+
+func (m *RealClient) MGet(keys ...string) (map[string]string, error) {
+	now := m.now()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	kvs := make(map[string]string, len(keys))
+	for _, k := range keys {
+		if e, ok := m.data[k]; ok && !e.expired(now) {
+			kvs[k] = e.value
+		}
+	}
+	return kvs, nil
+}
+
+func (m *RealClient) MSet(kvs map[string]string) error {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, v := range kvs {
+		m.store(k, entry{value: v}, now)
+	}
+	return nil
+}
+
+//替换后的值不再过期
+func (m *RealClient) CompareAndSwap(k, old, new string) (bool, error) {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.data[k]
+	if !ok || e.expired(now) || e.value != old {
+		return false, nil
+	}
+	m.store(k, entry{value: new}, now)
+	return true, nil
+}
+
+func (m *RealClient) GetOrSet(k, def string) (string, bool, error) {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.data[k]; ok && !e.expired(now) {
+		return e.value, true, nil
+	}
+	m.store(k, entry{value: def}, now)
+	return def, false, nil
+}
+
+//清理所有已过期的key，返回清理的个数
+func (m *RealClient) EvictExpired() int {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for k, e := range m.data {
+		if e.expired(now) {
+			delete(m.data, k)
+			m.notifyRemove(EventExpire, k, e)
+			n++
+		}
+	}
+	return n
+}
+
+//结束后台清理，并关闭所有订阅，可以重复调用
+func (m *RealClient) Close() error {
+	m.stopOnce.Do(func() {
+		if m.stop != nil {
+			close(m.stop)
+		}
+		m.closeWatchers()
+	})
+	return nil
+}
+
+func (m *RealClient) set(k string, e entry) {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store(k, e, now)
+}
+
+//写入并通知订阅方，调用方需要持有m.mu的写锁
+func (m *RealClient) store(k string, e entry, now time.Time) {
+	if m.data == nil {
+		m.data = map[string]entry{}
+	}
+	old, hadOld := m.data[k]
+	if hadOld && old.expired(now) {
+		hadOld = false
+		old = entry{}
+	}
+	m.data[k] = e
+	m.notifySet(k, old, hadOld, e)
+}
+
+//惰性删除，拿到写锁后需要再检查一次，期间key可能已经被重新写入
+func (m *RealClient) expire(k string) {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.data[k]; ok && e.expired(now) {
+		delete(m.data, k)
+		m.notifyRemove(EventExpire, k, e)
+	}
+}
+
+func (m *RealClient) evictLoop() {
+	ticker := time.NewTicker(m.evictInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.EvictExpired()
+		case <-m.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package common
+
+/*
+ * RealClient的并发测试，建议带上-race运行：
+ *    go test -race -run Storage ./common/
+ */
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestStorageClient(t *testing.T) {
+	convey.Convey("TestStorageClient", t, func() {
+		convey.Convey("get after set", func() {
+			client := NewStorageClient()
+			_, ok := client.Get("k1")
+			convey.So(ok, convey.ShouldBeFalse)
+
+			convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+			v, ok := client.Get("k1")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(v, convey.ShouldEqual, "v1")
+		})
+
+		convey.Convey("clients do not share data", func() {
+			c1 := NewStorageClient()
+			c2 := NewStorageClient()
+			convey.So(c1.Set("k1", "v1"), convey.ShouldBeNil)
+			_, ok := c2.Get("k1")
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("with store", func() {
+			store := map[string]string{"k1": "v1"}
+			client := NewStorageClientWithStore(store)
+			store["k1"] = "changed"
+			store["k2"] = "v2"
+
+			v, ok := client.Get("k1")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(v, convey.ShouldEqual, "v1")
+			_, ok = client.Get("k2")
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("zero value", func() {
+			client := &RealClient{}
+			_, ok := client.Get("k1")
+			convey.So(ok, convey.ShouldBeFalse)
+			convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+			v, _ := client.Get("k1")
+			convey.So(v, convey.ShouldEqual, "v1")
+		})
+	})
+}
+
+//并行的case各自持有client，互相之间不会串数据
+func TestStorageClientParallel(t *testing.T) {
+	for i := 0; i < 8; i++ {
+		i := i
+		t.Run("case"+strconv.Itoa(i), func(t *testing.T) {
+			t.Parallel()
+			client := NewStorageClient()
+			for j := 0; j < 1000; j++ {
+				if err := client.Set("key", strconv.Itoa(i)); err != nil {
+					t.Fatalf("Set() error = %v", err)
+				}
+				if v, _ := client.Get("key"); v != strconv.Itoa(i) {
+					t.Fatalf("Get() = %v, want %v", v, i)
+				}
+			}
+		})
+	}
+}
+
+//大量goroutine同时读写同一个client
+func TestStorageClientStress(t *testing.T) {
+	const (
+		writers = 32
+		readers = 32
+		rounds  = 2000
+	)
+	client := NewStorageClient()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				k := fmt.Sprintf("w%d-k%d", w, i%100)
+				if err := client.Set(k, strconv.Itoa(i)); err != nil {
+					t.Errorf("Set() error = %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				client.Get(fmt.Sprintf("w%d-k%d", r%writers, i%100))
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	//每个key最后一次写入的值一定是round中最大的那个
+	for w := 0; w < writers; w++ {
+		for i := 0; i < 100; i++ {
+			v, ok := client.Get(fmt.Sprintf("w%d-k%d", w, i))
+			if !ok {
+				t.Fatalf("key w%d-k%d should exist", w, i)
+			}
+			if want := strconv.Itoa(rounds - 100 + i); v != want {
+				t.Fatalf("Get(w%d-k%d) = %v, want %v", w, i, v, want)
+			}
+		}
+	}
+}
+
+func TestStorageClientTTL(t *testing.T) {
+	convey.Convey("TestStorageClientTTL", t, func() {
+		clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		client := NewRealClient(WithClock(clock))
+
+		convey.Convey("expire after ttl", func() {
+			convey.So(client.SetWithTTL("k1", "v1", 10*time.Second), convey.ShouldBeNil)
+			ttl, ok := client.TTL("k1")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(ttl, convey.ShouldEqual, 10*time.Second)
+
+			clock.Advance(9 * time.Second)
+			v, ok := client.Get("k1")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(v, convey.ShouldEqual, "v1")
+			ttl, _ = client.TTL("k1")
+			convey.So(ttl, convey.ShouldEqual, time.Second)
+
+			clock.Advance(time.Second)
+			_, ok = client.Get("k1")
+			convey.So(ok, convey.ShouldBeFalse)
+			_, ok = client.TTL("k1")
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("set clears ttl", func() {
+			convey.So(client.SetWithTTL("k1", "v1", time.Second), convey.ShouldBeNil)
+			convey.So(client.Set("k1", "v2"), convey.ShouldBeNil)
+			clock.Advance(time.Hour)
+			v, ok := client.Get("k1")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(v, convey.ShouldEqual, "v2")
+			ttl, _ := client.TTL("k1")
+			convey.So(ttl, convey.ShouldEqual, NoExpiry)
+		})
+
+		convey.Convey("invalid ttl", func() {
+			convey.So(client.SetWithTTL("k1", "v1", 0), convey.ShouldNotBeNil)
+			_, ok := client.Get("k1")
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("evict expired", func() {
+			convey.So(client.SetWithTTL("k1", "v1", time.Second), convey.ShouldBeNil)
+			convey.So(client.SetWithTTL("k2", "v2", time.Minute), convey.ShouldBeNil)
+			convey.So(client.Set("k3", "v3"), convey.ShouldBeNil)
+
+			convey.So(client.EvictExpired(), convey.ShouldEqual, 0)
+			clock.Advance(time.Second)
+			convey.So(client.EvictExpired(), convey.ShouldEqual, 1)
+			clock.Advance(time.Minute)
+			convey.So(client.EvictExpired(), convey.ShouldEqual, 1)
+			convey.So(len(client.data), convey.ShouldEqual, 1)
+		})
+	})
+}
+
+//后台定期清理，时间用FakeClock拨动，只等待后台goroutine跑一轮
+func TestStorageClientEvictLoop(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	client := NewRealClient(WithClock(clock), WithEvictInterval(time.Millisecond))
+	defer client.Close()
+
+	if err := client.SetWithTTL("k1", "v1", time.Second); err != nil {
+		t.Fatalf("SetWithTTL() error = %v", err)
+	}
+	clock.Advance(time.Second)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		client.mu.RLock()
+		n := len(client.data)
+		client.mu.RUnlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("expired key should be evicted by the background loop")
+}
+
+func TestStorageClientKeys(t *testing.T) {
+	convey.Convey("TestStorageClientKeys", t, func() {
+		clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		client := NewRealClient(WithClock(clock))
+		for _, k := range []string{"user:3", "user:1", "movie:1", "user:2"} {
+			convey.So(client.Set(k, "v"), convey.ShouldBeNil)
+		}
+
+		convey.Convey("delete and exists", func() {
+			convey.So(client.Exists("user:1"), convey.ShouldBeTrue)
+			convey.So(client.Delete("user:1"), convey.ShouldBeNil)
+			convey.So(client.Exists("user:1"), convey.ShouldBeFalse)
+			convey.So(client.Delete("user:1"), convey.ShouldBeNil)
+		})
+
+		convey.Convey("keys are sorted and skip expired", func() {
+			convey.So(client.SetWithTTL("tmp", "v", time.Second), convey.ShouldBeNil)
+			clock.Advance(time.Second)
+			keys, err := client.Keys()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"movie:1", "user:1", "user:2", "user:3"})
+		})
+
+		convey.Convey("scan by prefix with cursor", func() {
+			keys, next, err := client.Scan("user:", "", 2)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"user:1", "user:2"})
+			convey.So(next, convey.ShouldNotEqual, "")
+
+			//两批之间的写入不影响后续遍历
+			convey.So(client.Delete("user:1"), convey.ShouldBeNil)
+			keys, next, err = client.Scan("user:", next, 2)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"user:3"})
+			convey.So(next, convey.ShouldEqual, "")
+		})
+
+		convey.Convey("scan without limit", func() {
+			keys, next, err := client.Scan("", "", 0)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(keys), convey.ShouldEqual, 4)
+			convey.So(next, convey.ShouldEqual, "")
+		})
+	})
+}
+
+func TestStorageClientAtomic(t *testing.T) {
+	convey.Convey("TestStorageClientAtomic", t, func() {
+		clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		client := NewRealClient(WithClock(clock))
+
+		convey.Convey("mget and mset", func() {
+			convey.So(client.MSet(map[string]string{"k1": "v1", "k2": "v2"}), convey.ShouldBeNil)
+			convey.So(client.SetWithTTL("k3", "v3", time.Second), convey.ShouldBeNil)
+			clock.Advance(time.Second)
+
+			kvs, err := client.MGet("k1", "k2", "k3", "k4")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(kvs, convey.ShouldResemble, map[string]string{"k1": "v1", "k2": "v2"})
+		})
+
+		convey.Convey("compare and swap", func() {
+			ok, err := client.CompareAndSwap("k1", "", "v1")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(ok, convey.ShouldBeFalse)
+
+			convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+			ok, _ = client.CompareAndSwap("k1", "other", "v2")
+			convey.So(ok, convey.ShouldBeFalse)
+			ok, _ = client.CompareAndSwap("k1", "v1", "v2")
+			convey.So(ok, convey.ShouldBeTrue)
+			v, _ := client.Get("k1")
+			convey.So(v, convey.ShouldEqual, "v2")
+		})
+
+		convey.Convey("get or set", func() {
+			v, loaded, err := client.GetOrSet("k1", "v1")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(loaded, convey.ShouldBeFalse)
+			convey.So(v, convey.ShouldEqual, "v1")
+
+			v, loaded, _ = client.GetOrSet("k1", "v2")
+			convey.So(loaded, convey.ShouldBeTrue)
+			convey.So(v, convey.ShouldEqual, "v1")
+
+			//过期的key视为不存在
+			convey.So(client.SetWithTTL("k2", "old", time.Second), convey.ShouldBeNil)
+			clock.Advance(time.Second)
+			v, loaded, _ = client.GetOrSet("k2", "new")
+			convey.So(loaded, convey.ShouldBeFalse)
+			convey.So(v, convey.ShouldEqual, "new")
+		})
+	})
+}
+
+//并发CAS自增，每次成功的CAS都对应一次自增，最终结果不会丢失更新
+func TestStorageClientCASStress(t *testing.T) {
+	client := NewRealClient()
+	client.Set("counter", "0")
+
+	const goroutines, rounds = 16, 200
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				for {
+					old, _ := client.Get("counter")
+					n, _ := strconv.Atoi(old)
+					if ok, _ := client.CompareAndSwap("counter", old, strconv.Itoa(n+1)); ok {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := client.Get("counter"); v != strconv.Itoa(goroutines*rounds) {
+		t.Errorf("counter = %v, want %v", v, goroutines*rounds)
+	}
+}
@@ -0,0 +1,327 @@
+//StorageClient的一致性测试
+//所有StorageClient的实现都应该在自己的单测里跑一遍RunConformance，保证行为一致，不必各写一套用例
+package storagetest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/hq-cml/go-unittest/common"
+)
+
+//创建一个空的、待测的client，以及释放它的函数
+//每个子测试都会调用一次，各个子测试之间的数据互不影响
+type Factory func(t *testing.T) (common.StorageClient, func())
+
+//一致性测试覆盖的key，包括多字节字符、空白和控制字符
+var conformanceKeys = []string{
+	"k1",
+	"电影",
+	"ключ",
+	"🎬:1",
+	"a b",
+	"tab\tkey",
+	"line\r\nbreak",
+	"mixed:中文/😀",
+}
+
+//Scan最多翻的页数，超过则认为游标没有终止
+const maxScanPages = 10000
+
+//对factory创建的client跑一遍StorageClient的行为约定
+func RunConformance(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, c common.StorageClient)
+	}{
+		{"ReadYourWrites", testReadYourWrites},
+		{"MissingKey", testMissingKey},
+		{"EmptyValue", testEmptyValue},
+		{"Overwrite", testOverwrite},
+		{"Delete", testDelete},
+		{"UnicodeKeys", testUnicodeKeys},
+		{"KeysAndScan", testKeysAndScan},
+		{"Concurrent", testConcurrent},
+		{"ConcurrentSameKey", testConcurrentSameKey},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c, closeFn := factory(t)
+			defer closeFn()
+			tt.fn(t, c)
+		})
+	}
+}
+
+func mustSet(t *testing.T, c common.StorageClient, k, v string) {
+	t.Helper()
+	if err := c.Set(k, v); err != nil {
+		t.Fatalf("Set(%q, %q) error = %v", k, v, err)
+	}
+}
+
+func expectValue(t *testing.T, c common.StorageClient, k, want string) {
+	t.Helper()
+	v, ok := c.Get(k)
+	if !ok || v != want {
+		t.Errorf("Get(%q) = (%q, %v), want (%q, true)", k, v, ok, want)
+	}
+	if !c.Exists(k) {
+		t.Errorf("Exists(%q) = false, want true", k)
+	}
+}
+
+func expectMissing(t *testing.T, c common.StorageClient, k string) {
+	t.Helper()
+	v, ok := c.Get(k)
+	if ok || v != "" {
+		t.Errorf("Get(%q) = (%q, %v), want (\"\", false)", k, v, ok)
+	}
+	if c.Exists(k) {
+		t.Errorf("Exists(%q) = true, want false", k)
+	}
+}
+
+func testReadYourWrites(t *testing.T, c common.StorageClient) {
+	for i := 0; i < 10; i++ {
+		k, v := "key"+strconv.Itoa(i), "value"+strconv.Itoa(i)
+		mustSet(t, c, k, v)
+		expectValue(t, c, k, v)
+	}
+	//后写入的key不影响之前的
+	for i := 0; i < 10; i++ {
+		expectValue(t, c, "key"+strconv.Itoa(i), "value"+strconv.Itoa(i))
+	}
+}
+
+func testMissingKey(t *testing.T, c common.StorageClient) {
+	expectMissing(t, c, "missing")
+	mustSet(t, c, "prefix", "v")
+	expectMissing(t, c, "prefix:missing")
+	expectMissing(t, c, "prefi")
+}
+
+func testEmptyValue(t *testing.T, c common.StorageClient) {
+	mustSet(t, c, "empty", "")
+	expectValue(t, c, "empty", "")
+
+	mustSet(t, c, "empty", "v")
+	mustSet(t, c, "empty", "")
+	expectValue(t, c, "empty", "")
+}
+
+func testOverwrite(t *testing.T, c common.StorageClient) {
+	mustSet(t, c, "k1", "v1")
+	mustSet(t, c, "k1", "v2")
+	expectValue(t, c, "k1", "v2")
+
+	//覆盖不会产生重复的key
+	keys, err := c.Keys()
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "k1" {
+		t.Errorf("Keys() = %q, want [\"k1\"]", keys)
+	}
+}
+
+func testDelete(t *testing.T, c common.StorageClient) {
+	mustSet(t, c, "k1", "v1")
+	mustSet(t, c, "k2", "v2")
+	if err := c.Delete("k1"); err != nil {
+		t.Fatalf("Delete(k1) error = %v", err)
+	}
+	expectMissing(t, c, "k1")
+	expectValue(t, c, "k2", "v2")
+
+	//删除不存在的key不是错误
+	if err := c.Delete("k1"); err != nil {
+		t.Errorf("Delete(k1) again error = %v", err)
+	}
+	if err := c.Delete("missing"); err != nil {
+		t.Errorf("Delete(missing) error = %v", err)
+	}
+
+	//删除之后可以重新写入
+	mustSet(t, c, "k1", "v3")
+	expectValue(t, c, "k1", "v3")
+}
+
+func testUnicodeKeys(t *testing.T, c common.StorageClient) {
+	for i, k := range conformanceKeys {
+		mustSet(t, c, k, "值-"+strconv.Itoa(i)+"-😀")
+	}
+	for i, k := range conformanceKeys {
+		expectValue(t, c, k, "值-"+strconv.Itoa(i)+"-😀")
+	}
+	expectKeys(t, c, "", conformanceKeys)
+	//按字节前缀匹配
+	expectKeys(t, c, "电", []string{"电影"})
+}
+
+func testKeysAndScan(t *testing.T, c common.StorageClient) {
+	expectKeys(t, c, "", nil)
+
+	var want []string
+	for i := 0; i < 25; i++ {
+		k := fmt.Sprintf("scan:%02d", i)
+		mustSet(t, c, k, "v")
+		want = append(want, k)
+	}
+	mustSet(t, c, "other", "v")
+	expectKeys(t, c, "scan:", want)
+	expectKeys(t, c, "", append(want, "other"))
+	expectKeys(t, c, "nothing:", nil)
+}
+
+//分别用Keys和不同大小的Scan分页取出prefix下的所有key，和want比较
+//每批返回的key不能超过limit，但可以更少甚至为空(例如RESP先按COUNT遍历再过滤)，只要求最终能遍历完
+func expectKeys(t *testing.T, c common.StorageClient, prefix string, want []string) {
+	t.Helper()
+	want = sorted(want)
+
+	if prefix == "" {
+		keys, err := c.Keys()
+		if err != nil {
+			t.Fatalf("Keys() error = %v", err)
+		}
+		if got := sorted(keys); !equal(got, want) {
+			t.Errorf("Keys() = %q, want %q", got, want)
+		}
+	}
+
+	for _, limit := range []int{1, 7, 100} {
+		var got []string
+		seen := map[string]bool{}
+		cursor := ""
+		for page := 0; ; page++ {
+			if page > maxScanPages {
+				t.Fatalf("Scan(%q, limit=%d) does not terminate", prefix, limit)
+			}
+			keys, next, err := c.Scan(prefix, cursor, limit)
+			if err != nil {
+				t.Fatalf("Scan(%q, %q, %d) error = %v", prefix, cursor, limit, err)
+			}
+			if len(keys) > limit {
+				t.Errorf("Scan(%q, %q, %d) returned %d keys", prefix, cursor, limit, len(keys))
+			}
+			for _, k := range keys {
+				if seen[k] {
+					t.Errorf("Scan(%q, limit=%d) returned %q twice", prefix, limit, k)
+				}
+				seen[k] = true
+				got = append(got, k)
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		if got = sorted(got); !equal(got, want) {
+			t.Errorf("Scan(%q, limit=%d) = %q, want %q", prefix, limit, got, want)
+		}
+	}
+}
+
+//多个goroutine各自读写自己的key
+func testConcurrent(t *testing.T, c common.StorageClient) {
+	const workers, rounds = 8, 50
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 2*workers*rounds)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				k := fmt.Sprintf("w%d:%d", w, i)
+				v := fmt.Sprintf("v%d", i)
+				if err := c.Set(k, v); err != nil {
+					errs <- fmt.Sprintf("Set(%q) error = %v", k, err)
+					continue
+				}
+				if got, ok := c.Get(k); !ok || got != v {
+					errs <- fmt.Sprintf("Get(%q) = (%q, %v), want (%q, true)", k, got, ok, v)
+				}
+				if i%2 == 1 {
+					if err := c.Delete(k); err != nil {
+						errs <- fmt.Sprintf("Delete(%q) error = %v", k, err)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for msg := range errs {
+		t.Error(msg)
+	}
+
+	var want []string
+	for w := 0; w < workers; w++ {
+		for i := 0; i < rounds; i += 2 {
+			want = append(want, fmt.Sprintf("w%d:%d", w, i))
+		}
+	}
+	expectKeys(t, c, "", want)
+}
+
+//多个goroutine同时读写同一个key，读到的只能是某一次写入的完整值
+func testConcurrentSameKey(t *testing.T, c common.StorageClient) {
+	const workers, rounds = 8, 50
+	mustSet(t, c, "shared", "init")
+
+	valid := map[string]bool{"init": true}
+	for w := 0; w < workers; w++ {
+		valid[fmt.Sprintf("writer-%d", w)] = true
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 2*workers*rounds)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				if err := c.Set("shared", fmt.Sprintf("writer-%d", w)); err != nil {
+					errs <- fmt.Sprintf("Set(shared) error = %v", err)
+				}
+				if v, ok := c.Get("shared"); !ok || !valid[v] {
+					errs <- fmt.Sprintf("Get(shared) = (%q, %v)", v, ok)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for msg := range errs {
+		t.Error(msg)
+	}
+
+	v, ok := c.Get("shared")
+	if !ok || !valid[v] || v == "init" {
+		t.Errorf("Get(shared) = (%q, %v) after writers finished", v, ok)
+	}
+}
+
+func sorted(keys []string) []string {
+	s := append([]string{}, keys...)
+	sort.Strings(s)
+	return s
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package storagetest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hq-cml/go-unittest/common"
+)
+
+func noop() {}
+
+func TestRealClient(t *testing.T) {
+	RunConformance(t, func(t *testing.T) (common.StorageClient, func()) {
+		c := common.NewRealClient()
+		return c, func() { c.Close() }
+	})
+}
+
+func TestStorageClientWithStore(t *testing.T) {
+	RunConformance(t, func(t *testing.T) (common.StorageClient, func()) {
+		return common.NewStorageClientWithStore(map[string]string{}), noop
+	})
+}
+
+func TestFileClient(t *testing.T) {
+	RunConformance(t, func(t *testing.T) (common.StorageClient, func()) {
+		dir, err := ioutil.TempDir("", "storagetest")
+		if err != nil {
+			t.Fatalf("TempDir() error = %v", err)
+		}
+		c, err := common.NewFileStorageClient(filepath.Join(dir, "data.log"))
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatalf("NewFileStorageClient() error = %v", err)
+		}
+		return c, func() {
+			c.Close()
+			os.RemoveAll(dir)
+		}
+	})
+}
+
+func TestRESPClient(t *testing.T) {
+	RunConformance(t, func(t *testing.T) (common.StorageClient, func()) {
+		server, err := common.StartRESPServer("127.0.0.1:0", common.NewRealClient())
+		if err != nil {
+			t.Fatalf("StartRESPServer() error = %v", err)
+		}
+		c, err := common.NewRESPStorageClient(server.Addr(), common.WithRESPTimeout(time.Second))
+		if err != nil {
+			server.Close()
+			t.Fatalf("NewRESPStorageClient() error = %v", err)
+		}
+		return c, func() {
+			c.Close()
+			server.Close()
+		}
+	})
+}
+
+func TestLRUClient(t *testing.T) {
+	RunConformance(t, func(t *testing.T) (common.StorageClient, func()) {
+		return common.NewLRUStorageClient(common.LRUConfig{MaxEntries: 10000}), noop
+	})
+}
+
+//装饰器不能改变被包装client的行为
+func TestDecorators(t *testing.T) {
+	tests := []struct {
+		name string
+		wrap func(common.StorageClient) common.StorageClient
+	}{
+		{"Context", func(c common.StorageClient) common.StorageClient {
+			return common.NewPlainClient(common.NewContextClient(c))
+		}},
+		{"Instrumented", func(c common.StorageClient) common.StorageClient {
+			return common.NewInstrumentedClient(c)
+		}},
+		{"Retry", func(c common.StorageClient) common.StorageClient {
+			return common.NewRetryClient(c, common.RetryConfig{
+				Retry:   common.RetryPolicy{MaxAttempts: 3},
+				Breaker: common.BreakerPolicy{FailureThreshold: 5, OpenTimeout: time.Second},
+			})
+		}},
+		{"Fault", func(c common.StorageClient) common.StorageClient {
+			return common.NewFaultClient(c, common.FaultConfig{})
+		}},
+		{"Recording", func(c common.StorageClient) common.StorageClient {
+			return common.NewRecordingClient(c)
+		}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			RunConformance(t, func(t *testing.T) (common.StorageClient, func()) {
+				return tt.wrap(common.NewLRUStorageClient(common.LRUConfig{})), noop
+			})
+		})
+	}
+}
+
+func TestShardedClient(t *testing.T) {
+	RunConformance(t, func(t *testing.T) (common.StorageClient, func()) {
+		return common.NewShardedStorageClient(common.ShardedConfig{Shards: 4}), noop
+	})
+}
@@ -0,0 +1,253 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+ * 基于struct tag的校验，规则之间用逗号分隔，按顺序检查，每个字段只报告第一个不满足的规则
+ *   required      不能是零值
+ *   min=N, max=N  整数的取值范围，字符串的rune个数范围
+ *   oneof=a b c   只能是列出的值之一，用空格分隔
+ * 例如：
+ *   Score int `validate:"min=0,max=100"`
+ * 嵌套的struct和slice会递归检查，字段名形如Movies[2].Score，指针形成环时环上的值只检查一次
+ */
+
+//校验不通过，具体错误为*ValidationError
+var ErrInvalid = errors.New("validation failed")
+
+//一个字段不满足规则
+type FieldError struct {
+	Field string      //字段名，嵌套时带上路径
+	Rule  string      //规则名，例如min
+	Param string      //规则的参数，例如100
+	Value interface{} //字段的值
+}
+
+func (e *FieldError) Error() string {
+	var msg string
+	switch e.Rule {
+	case "required":
+		msg = "is required"
+	case "min":
+		msg = "must be at least " + e.Param
+	case "max":
+		msg = "must be at most " + e.Param
+	case "oneof":
+		msg = "must be one of [" + e.Param + "]"
+	default:
+		msg = "failed rule " + e.Rule
+	}
+	if _, ok := e.Value.(string); ok && (e.Rule == "min" || e.Rule == "max") {
+		msg = "length " + msg
+	}
+	return fmt.Sprintf("%s %s, got %#v", e.Field, msg, e.Value)
+}
+
+//所有不满足规则的字段
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Error()
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+//按validate tag检查v，v可以是struct、slice或者它们的指针，其他类型不做检查
+//全部通过返回nil，否则返回*ValidationError，tag写错时返回普通的error
+func Validate(v interface{}) error {
+	var errs []*FieldError
+	if err := validateValue(reflect.ValueOf(v), "", &errs, map[visit]bool{}); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+//Movie的校验规则见struct tag
+func (m Movie) Validate() error {
+	return Validate(m)
+}
+
+//正在检查的指针或者slice，用来发现环
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+//visiting为当前路径上的指针和slice，再次遇到说明有环，直接跳过
+func validateValue(v reflect.Value, path string, errs *[]*FieldError, visiting map[visit]bool) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Ptr {
+			key := visit{v.Pointer(), v.Type()}
+			if visiting[key] {
+				return nil
+			}
+			visiting[key] = true
+			defer delete(visiting, key)
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Len() > 0 {
+			key := visit{v.Pointer(), v.Type()}
+			if visiting[key] {
+				return nil
+			}
+			visiting[key] = true
+			defer delete(visiting, key)
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs, visiting); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue //未导出的字段
+			}
+			name := f.Name
+			if path != "" {
+				name = path + "." + name
+			}
+			fe, err := checkField(v.Field(i), name, f.Tag.Get("validate"))
+			if err != nil {
+				return err
+			}
+			if fe != nil {
+				*errs = append(*errs, fe)
+				continue
+			}
+			if err := validateValue(v.Field(i), name, errs, visiting); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//按顺序检查tag中的规则，返回第一个不满足的
+func checkField(v reflect.Value, name, tag string) (*FieldError, error) {
+	if tag == "" {
+		return nil, nil
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		rule, param := splitRule(rule)
+		ok, err := checkRule(v, rule, param)
+		if err != nil {
+			return nil, fmt.Errorf("validate: field %s: %v", name, err)
+		}
+		if !ok {
+			return &FieldError{Field: name, Rule: rule, Param: param, Value: v.Interface()}, nil
+		}
+	}
+	return nil, nil
+}
+
+func splitRule(s string) (string, string) {
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		return strings.TrimSpace(s[:i]), s[i+1:]
+	}
+	return strings.TrimSpace(s), ""
+}
+
+func checkRule(v reflect.Value, rule, param string) (bool, error) {
+	switch rule {
+	case "required":
+		return !v.IsZero(), nil
+	case "min", "max":
+		limit, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s parameter %q", rule, param)
+		}
+		var n int64
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = v.Int()
+		case reflect.String:
+			n = int64(utf8.RuneCountInString(v.String()))
+		default:
+			return false, fmt.Errorf("rule %s does not apply to %s", rule, v.Kind())
+		}
+		if rule == "min" {
+			return n >= limit, nil
+		}
+		return n <= limit, nil
+	case "oneof":
+		var s string
+		switch v.Kind() {
+		case reflect.String:
+			s = v.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			s = strconv.FormatInt(v.Int(), 10)
+		default:
+			return false, fmt.Errorf("rule oneof does not apply to %s", v.Kind())
+		}
+		for _, allowed := range strings.Fields(param) {
+			if s == allowed {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown rule %q", rule)
+}
+
+//在Unmarshal之后自动校验，校验不通过返回*ValidationError
+//v为非nil指针时先解码到同类型的新值，校验通过后才复制到v，解码或者校验失败时v保持不变
+//因此v中原有的内容不会和解码结果合并，这一点和直接用json.Unmarshal不同
+func NewValidatingDecoder(d Decoder) Decoder {
+	return validatingDecoder{d}
+}
+
+type validatingDecoder struct {
+	d Decoder
+}
+
+func (d validatingDecoder) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		//交给d返回相应的错误
+		if err := d.d.Unmarshal(data, v); err != nil {
+			return err
+		}
+		return Validate(v)
+	}
+	fresh := reflect.New(rv.Elem().Type())
+	if err := d.d.Unmarshal(data, fresh.Interface()); err != nil {
+		return err
+	}
+	if err := Validate(fresh.Interface()); err != nil {
+		return err
+	}
+	rv.Elem().Set(fresh.Elem())
+	return nil
+}
+
+type validatingCodec struct {
+	Encoder
+	validatingDecoder
+}
@@ -0,0 +1,160 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestMovieValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		movie  Movie
+		fields []string //不通过的字段和规则，形如Score:max
+	}{
+		{"valid", Movie{Name: "Titanic", Type: "Love", Score: 95}, nil},
+		{"score bounds", Movie{Name: "a", Type: "Drama", Score: 0}, nil},
+		{"score 100", Movie{Name: "a", Type: "Drama", Score: 100}, nil},
+		{"score too high", Movie{Name: "a", Type: "Drama", Score: 101}, []string{"Score:max"}},
+		{"score negative", Movie{Name: "a", Type: "Drama", Score: -1}, []string{"Score:min"}},
+		{"unknown genre", Movie{Name: "a", Type: "love", Score: 1}, []string{"Type:oneof"}},
+		{"empty type reports required only", Movie{Name: "a", Score: 1}, []string{"Type:required"}},
+		{"everything wrong", Movie{Score: 1000}, []string{"Name:required", "Type:required", "Score:max"}},
+	}
+	for _, tt := range tests {
+		err := tt.movie.Validate()
+		if tt.fields == nil {
+			if err != nil {
+				t.Errorf("%s: Validate() = %v, want nil", tt.name, err)
+			}
+			continue
+		}
+		var verr *ValidationError
+		if !errors.As(err, &verr) || !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: Validate() = %v, want *ValidationError", tt.name, err)
+			continue
+		}
+		var got []string
+		for _, fe := range verr.Errors {
+			got = append(got, fe.Field+":"+fe.Rule)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.fields, ",") {
+			t.Errorf("%s: failing fields = %v, want %v", tt.name, got, tt.fields)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	convey.Convey("TestValidate", t, func() {
+		convey.Convey("error message lists every field", func() {
+			err := Movie{Type: "Love", Score: 101}.Validate()
+			convey.So(err.Error(), convey.ShouldEqual,
+				`validation failed: Name is required, got ""; Score must be at most 100, got 101`)
+		})
+
+		convey.Convey("nested structs and slices", func() {
+			type catalog struct {
+				Owner  string `validate:"required,min=2"`
+				Movies []*Movie
+				Best   Movie
+				note   string `validate:"required"`
+			}
+			c := &catalog{
+				Owner:  "x",
+				Movies: []*Movie{{Name: "a", Type: "Love"}, nil, {Name: "b", Type: "Love", Score: -5}},
+				Best:   Movie{Name: "c", Type: "Horror"},
+			}
+			var verr *ValidationError
+			convey.So(errors.As(Validate(c), &verr), convey.ShouldBeTrue)
+			convey.So(len(verr.Errors), convey.ShouldEqual, 2)
+			convey.So(verr.Errors[0].Error(), convey.ShouldEqual, `Owner length must be at least 2, got "x"`)
+			convey.So(verr.Errors[1].Field, convey.ShouldEqual, "Movies[2].Score")
+		})
+
+		convey.Convey("cycles", func() {
+			type node struct {
+				Name string `validate:"required"`
+				Next *node
+				Kids []interface{}
+			}
+			a := &node{Name: "a"}
+			b := &node{Next: a}
+			a.Next = b
+			a.Kids = []interface{}{a, b}
+			var verr *ValidationError
+			convey.So(errors.As(Validate(a), &verr), convey.ShouldBeTrue)
+			convey.So(len(verr.Errors), convey.ShouldEqual, 2)
+			convey.So(verr.Errors[0].Field, convey.ShouldEqual, "Next.Name")
+			convey.So(verr.Errors[1].Field, convey.ShouldEqual, "Kids[1].Name")
+		})
+
+		convey.Convey("other types are not checked", func() {
+			convey.So(Validate(nil), convey.ShouldBeNil)
+			convey.So(Validate(42), convey.ShouldBeNil)
+			convey.So(Validate((*Movie)(nil)), convey.ShouldBeNil)
+		})
+
+		convey.Convey("bad tags", func() {
+			tests := []interface{}{
+				struct {
+					A int `validate:"between=1"`
+				}{},
+				struct {
+					A int `validate:"max=ten"`
+				}{},
+				struct {
+					A bool `validate:"min=1"`
+				}{},
+			}
+			for _, v := range tests {
+				err := Validate(v)
+				convey.So(err, convey.ShouldNotBeNil)
+				convey.So(errors.Is(err, ErrInvalid), convey.ShouldBeFalse)
+			}
+		})
+	})
+}
+
+func TestValidatingDecoder(t *testing.T) {
+	convey.Convey("TestValidatingDecoder", t, func() {
+		convey.Convey("wrap a decoder", func() {
+			dec := NewValidatingDecoder(NewDecoder())
+			var m Movie
+			convey.So(dec.Unmarshal([]byte(`{"Name":"Titanic","Type":"Love","Score":95}`), &m), convey.ShouldBeNil)
+			err := dec.Unmarshal([]byte(`{"Name":"Titanic","Type":"Love","Score":950}`), &m)
+			convey.So(errors.Is(err, ErrInvalid), convey.ShouldBeTrue)
+			//校验失败时不修改m
+			convey.So(m, convey.ShouldResemble, Movie{Name: "Titanic", Type: "Love", Score: 95})
+			var movies []Movie
+			err = dec.Unmarshal([]byte(`[{"Name":"a","Type":"Love"},{"Name":"b"}]`), &movies)
+			convey.So(errors.Is(err, ErrInvalid), convey.ShouldBeTrue)
+			convey.So(movies, convey.ShouldBeNil)
+			convey.So(dec.Unmarshal([]byte(`{}`), nil), convey.ShouldNotBeNil)
+			//解码本身的错误原样返回
+			err = dec.Unmarshal([]byte(`{`), &m)
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(errors.Is(err, ErrInvalid), convey.ShouldBeFalse)
+		})
+
+		convey.Convey("codec option", func() {
+			c, err := NewCodec(WithFormat(FormatXML), WithValidation())
+			convey.So(err, convey.ShouldBeNil)
+			data, err := c.Marshal(Movie{Name: "a", Type: "Bad"})
+			convey.So(err, convey.ShouldBeNil)
+			var m Movie
+			convey.So(errors.Is(c.Unmarshal(data, &m), ErrInvalid), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("ndjson fixtures", func() {
+			input := "{\"Name\":\"a\",\"Type\":\"Love\",\"Score\":1}\n{\"Name\":\"b\",\"Type\":\"Love\",\"Score\":101}\n"
+			s := NewMovieScanner(strings.NewReader(input), WithLineDecoder(NewValidatingDecoder(JSONCodec{})))
+			convey.So(len(scanMovies(s)), convey.ShouldEqual, 1)
+			var lerr *LineError
+			convey.So(errors.As(s.Err(), &lerr), convey.ShouldBeTrue)
+			convey.So(lerr.Line, convey.ShouldEqual, 2)
+			convey.So(errors.Is(s.Err(), ErrInvalid), convey.ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,175 @@
+package common
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//变更事件的类型
+type EventType int
+
+const (
+	EventSet    EventType = iota + 1 //写入
+	EventDelete                      //删除
+	EventExpire                      //过期被清理
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "delete"
+	case EventExpire:
+		return "expire"
+	}
+	return "unknown"
+}
+
+//一次变更
+type Event struct {
+	Type     EventType
+	Key      string
+	OldValue string
+	HadOld   bool   //变更前key是否存在，不存在时OldValue为空串
+	NewValue string //删除和过期时为空串
+	//在这个事件之前，因为消费太慢而被丢弃的事件个数
+	Dropped uint64
+}
+
+//支持订阅变更的存储
+type Watcher interface {
+	//订阅单个key的变更
+	Watch(key string) *Subscription
+	//订阅所有以prefix开头的key的变更，prefix为空串表示订阅全部
+	WatchPrefix(prefix string) *Subscription
+}
+
+//一个订阅
+//事件按照变更发生的顺序投递到C中，C的缓冲满了之后新的事件会被丢弃，不会阻塞写入方
+//丢弃的个数记在下一个成功投递的事件的Dropped中，也可以通过Dropped()查看总数
+type Subscription struct {
+	C <-chan Event
+
+	ch      chan Event
+	key     string
+	prefix  bool
+	pending uint64 //还没有通知给订阅方的丢弃个数
+	dropped uint64 //丢弃总数，原子操作
+	once    sync.Once
+	cancel  func()
+}
+
+func (s *Subscription) match(k string) bool {
+	if s.prefix {
+		return strings.HasPrefix(k, s.key)
+	}
+	return k == s.key
+}
+
+//非阻塞投递，调用方需要保证同一个订阅不会被并发投递
+func (s *Subscription) send(ev Event) {
+	ev.Dropped = s.pending
+	select {
+	case s.ch <- ev:
+		s.pending = 0
+	default:
+		s.pending++
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+//丢弃的事件总数
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+//取消订阅，C会被关闭，可以重复调用
+func (s *Subscription) Cancel() {
+	s.once.Do(s.cancel)
+}
+
+//每个订阅的默认缓冲大小
+const DefaultWatchBuffer = 64
+
+//订阅的缓冲大小，n<=0时使用DefaultWatchBuffer
+func WithWatchBuffer(n int) Option {
+	return func(m *RealClient) {
+		m.watchBuffer = n
+	}
+}
+
+func (m *RealClient) Watch(key string) *Subscription {
+	return m.subscribe(key, false)
+}
+
+func (m *RealClient) WatchPrefix(prefix string) *Subscription {
+	return m.subscribe(prefix, true)
+}
+
+func (m *RealClient) subscribe(key string, prefix bool) *Subscription {
+	size := m.watchBuffer
+	if size <= 0 {
+		size = DefaultWatchBuffer
+	}
+	ch := make(chan Event, size)
+	s := &Subscription{C: ch, ch: ch, key: key, prefix: prefix}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.watchers == nil {
+		m.watchers = map[*Subscription]struct{}{}
+	}
+	if m.watchClosed {
+		close(ch)
+		s.cancel = func() {}
+		return s
+	}
+	m.watchers[s] = struct{}{}
+	s.cancel = func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.watchers[s]; ok {
+			delete(m.watchers, s)
+			close(s.ch)
+		}
+	}
+	return s
+}
+
+//通知所有匹配的订阅，调用方需要持有m.mu的写锁，这样事件的顺序和变更的顺序一致
+func (m *RealClient) notify(ev Event) {
+	for s := range m.watchers {
+		if s.match(ev.Key) {
+			s.send(ev)
+		}
+	}
+}
+
+//k从old变成e时的通知，调用方需要持有m.mu的写锁
+func (m *RealClient) notifySet(k string, old entry, hadOld bool, e entry) {
+	if len(m.watchers) == 0 {
+		return
+	}
+	m.notify(Event{Type: EventSet, Key: k, OldValue: old.value, HadOld: hadOld, NewValue: e.value})
+}
+
+//k被删除或者过期时的通知，调用方需要持有m.mu的写锁
+func (m *RealClient) notifyRemove(typ EventType, k string, old entry) {
+	if len(m.watchers) == 0 {
+		return
+	}
+	m.notify(Event{Type: typ, Key: k, OldValue: old.value, HadOld: true})
+}
+
+//关闭所有订阅，之后新的订阅会立即被关闭
+func (m *RealClient) closeWatchers() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watchClosed = true
+	for s := range m.watchers {
+		delete(m.watchers, s)
+		close(s.ch)
+	}
+}
@@ -0,0 +1,174 @@
+package common
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+//从订阅中取出n个事件，超时则失败
+func recvEvents(t *testing.T, sub *Subscription, n int) []Event {
+	events := make([]Event, 0, n)
+	for len(events) < n {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				t.Fatalf("subscription closed after %d events, want %d", len(events), n)
+			}
+			events = append(events, ev)
+		case <-time.After(time.Second):
+			t.Fatalf("got %d events, want %d", len(events), n)
+		}
+	}
+	return events
+}
+
+func TestWatch(t *testing.T) {
+	convey.Convey("TestWatch", t, func() {
+		clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		client := NewRealClient(WithClock(clock))
+		defer client.Close()
+
+		convey.Convey("events of a key", func() {
+			sub := client.Watch("k1")
+			defer sub.Cancel()
+
+			client.Set("k1", "v1")
+			client.Set("other", "x")
+			client.Set("k1", "v2")
+			client.Delete("k1")
+			client.Delete("k1")
+
+			events := recvEvents(t, sub, 3)
+			convey.So(events[0], convey.ShouldResemble, Event{Type: EventSet, Key: "k1", NewValue: "v1"})
+			convey.So(events[1], convey.ShouldResemble, Event{Type: EventSet, Key: "k1", OldValue: "v1", HadOld: true, NewValue: "v2"})
+			convey.So(events[2], convey.ShouldResemble, Event{Type: EventDelete, Key: "k1", OldValue: "v2", HadOld: true})
+			convey.So(len(sub.C), convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("events of a prefix", func() {
+			sub := client.WatchPrefix("user:")
+			defer sub.Cancel()
+
+			client.MSet(map[string]string{"user:1": "a", "movie:1": "b"})
+			client.CompareAndSwap("user:1", "a", "b")
+			client.GetOrSet("user:2", "c")
+			client.GetOrSet("user:2", "d")
+
+			events := recvEvents(t, sub, 3)
+			convey.So(events[0].Key, convey.ShouldEqual, "user:1")
+			convey.So(events[1].OldValue, convey.ShouldEqual, "a")
+			convey.So(events[1].NewValue, convey.ShouldEqual, "b")
+			convey.So(events[2].Key, convey.ShouldEqual, "user:2")
+			convey.So(len(sub.C), convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("expire", func() {
+			sub := client.Watch("k1")
+			defer sub.Cancel()
+
+			client.SetWithTTL("k1", "v1", time.Second)
+			clock.Advance(time.Second)
+			convey.So(client.EvictExpired(), convey.ShouldEqual, 1)
+
+			events := recvEvents(t, sub, 2)
+			convey.So(events[1].Type, convey.ShouldEqual, EventExpire)
+			convey.So(events[1].OldValue, convey.ShouldEqual, "v1")
+		})
+
+		convey.Convey("cancel", func() {
+			sub := client.Watch("k1")
+			sub.Cancel()
+			sub.Cancel()
+			_, ok := <-sub.C
+			convey.So(ok, convey.ShouldBeFalse)
+			convey.So(len(client.watchers), convey.ShouldEqual, 0)
+
+			//取消之后的写入不会再投递
+			convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+		})
+
+		convey.Convey("close client", func() {
+			sub := client.Watch("k1")
+			client.Close()
+			_, ok := <-sub.C
+			convey.So(ok, convey.ShouldBeFalse)
+			sub.Cancel()
+
+			sub = client.Watch("k1")
+			_, ok = <-sub.C
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+	})
+}
+
+//消费太慢时丢弃事件，不阻塞写入方
+func TestWatchDropped(t *testing.T) {
+	client := NewRealClient(WithWatchBuffer(2))
+	sub := client.Watch("k1")
+	defer sub.Cancel()
+
+	for i := 0; i < 5; i++ {
+		client.Set("k1", strconv.Itoa(i))
+	}
+	if sub.Dropped() != 3 {
+		t.Errorf("Dropped() = %d, want 3", sub.Dropped())
+	}
+
+	events := recvEvents(t, sub, 2)
+	if events[0].NewValue != "0" || events[1].NewValue != "1" {
+		t.Errorf("events = %+v, want the first two", events)
+	}
+
+	//缓冲空出来之后，下一个事件带上之前丢弃的个数
+	client.Set("k1", "5")
+	ev := recvEvents(t, sub, 1)[0]
+	if ev.NewValue != "5" || ev.Dropped != 3 {
+		t.Errorf("event = %+v, want NewValue 5 and Dropped 3", ev)
+	}
+	client.Set("k1", "6")
+	if ev := recvEvents(t, sub, 1)[0]; ev.Dropped != 0 {
+		t.Errorf("Dropped = %d, want 0", ev.Dropped)
+	}
+}
+
+//并发写入同一个key时，事件的顺序和最终结果一致，并且每个订阅方看到的顺序相同
+func TestWatchOrdering(t *testing.T) {
+	const writers, rounds = 8, 100
+	client := NewRealClient(WithWatchBuffer(writers * rounds))
+	sub1 := client.Watch("k1")
+	sub2 := client.WatchPrefix("k")
+	defer sub1.Cancel()
+	defer sub2.Cancel()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				client.Set("k1", strconv.Itoa(w)+"-"+strconv.Itoa(i))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	events1 := recvEvents(t, sub1, writers*rounds)
+	events2 := recvEvents(t, sub2, writers*rounds)
+	for i := range events1 {
+		if events1[i] != events2[i] {
+			t.Fatalf("event %d differs: %+v vs %+v", i, events1[i], events2[i])
+		}
+		//每个事件的旧值就是上一个事件的新值
+		if i > 0 && events1[i].OldValue != events1[i-1].NewValue {
+			t.Fatalf("event %d OldValue = %v, want %v", i, events1[i].OldValue, events1[i-1].NewValue)
+		}
+	}
+	last, _ := client.Get("k1")
+	if events1[len(events1)-1].NewValue != last {
+		t.Errorf("last event = %v, stored %v", events1[len(events1)-1].NewValue, last)
+	}
+}
@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	bou.ke/monkey v1.0.2
+	github.com/DATA-DOG/go-sqlmock v1.3.2
 	github.com/agiledragon/gomonkey v2.0.2+incompatible
 	github.com/golang/mock v1.4.4
 	github.com/prashantv/gostub v1.0.0
@@ -1,22 +1,31 @@
 package gomock
 
 import (
-	"errors"
+	"context"
 	"github.com/hq-cml/go-unittest/common"
 )
 
 //client句柄从外部传入
 //典型的依赖注入场景
+//key不存在返回*common.NotFoundError，值不是"Hello world"返回*common.ValueMismatchError
 func CheckItemKey1(client common.StorageClient, key string) (bool, error) {
-	v, ok := client.Get(key)
+	return CheckItemKey1Context(context.Background(), common.NewContextClient(client), key)
+}
+
+//CheckItemKey1的context版本，ctx结束后返回ctx.Err()
+func CheckItemKey1Context(ctx context.Context, client common.ContextStorageClient, key string) (bool, error) {
+	v, ok, err := client.GetContext(ctx, key)
+	if err != nil {
+		return false, err
+	}
 	if !ok {
-		return false, errors.New("Shoud Exist!")
+		return false, &common.NotFoundError{Key: key}
 	}
 
 	if v == "Hello world" {
 		return true, nil
 	} else {
-		return false, errors.New("Value Wrong!")
+		return false, &common.ValueMismatchError{Key: key, Expected: "Hello world", Actual: v}
 	}
 }
 
@@ -26,37 +35,64 @@ func CheckItemKey2(key string) (bool, error) {
 	client := common.NewStorageClient()
 	v, ok := client.Get(key)
 	if !ok {
-		return false, errors.New("Shoud Exist!")
+		return false, &common.NotFoundError{Key: key}
 	}
 
 	if v == "Hello world" {
 		return true, nil
 	} else {
-		return false, errors.New("Value Wrong!")
+		return false, &common.ValueMismatchError{Key: key, Expected: "Hello world", Actual: v}
 	}
 }
 
 //如果存在则返回，否则用默认值设置
-//测试行为的保序
+//client支持原子操作(AtomicStorageClient)时用GetOrSet一步完成，多个goroutine同时对同一个key调用，拿到的都是同一个值
+//否则退化成Get->Set->Get三步，测试行为的保序
+//注意退化后不是原子的：并发调用时后Set的会覆盖先Set的，先Set的一方最后一步读到别人的值，返回*common.ValueMismatchError
+//是否原子只看client本身的类型：common中的InstrumentedClient、RetryClient、FaultClient、RecordingClient等装饰器
+//没有实现AtomicStorageClient，即使包装的是RealClient也会走非原子的三步，需要原子语义时不要经过这些装饰器
+//Set之后读不到返回*common.NotFoundError，读到的不是def返回*common.ValueMismatchError
 func Replace(client common.StorageClient, key,def string) (string, error) {
-	v, ok := client.Get(key)
+	if ac, ok := client.(common.AtomicStorageClient); ok {
+		v, _, err := common.GetOrSetContext(context.Background(), ac, key, def)
+		return v, err
+	}
+	return ReplaceContext(context.Background(), common.NewContextClient(client), key, def)
+}
+
+//Replace的context版本，ctx结束后返回ctx.Err()
+//原子和非原子两种方式的区别同Replace，client需要同时实现AtomicStorageClient才会走原子的GetOrSet
+//GetOrSet通过common.GetOrSetContext调用，client不支持context时ctx结束也会立即返回
+func ReplaceContext(ctx context.Context, client common.ContextStorageClient, key, def string) (string, error) {
+	if ac, ok := client.(common.AtomicStorageClient); ok {
+		v, _, err := common.GetOrSetContext(ctx, ac, key, def)
+		return v, err
+	}
+
+	v, ok, err := client.GetContext(ctx, key)
+	if err != nil {
+		return "", err
+	}
 	if ok {
 		return v, nil
 	}
 
-	err := client.Set(key, def)
+	err = client.SetContext(ctx, key, def)
 	if err != nil {
 		return "", err
 	}
 
-	v, ok = client.Get(key)
+	v, ok, err = client.GetContext(ctx, key)
+	if err != nil {
+		return "", err
+	}
 	if !ok {
-		return "", errors.New("Shoud Exist")
+		return "", &common.NotFoundError{Key: key}
 	}
 
 	if v != def {
-		return "", errors.New("Shoud =" + def)
+		return "", &common.ValueMismatchError{Key: key, Expected: def, Actual: v}
 	} else {
 		return def, nil
 	}
-}
\ No newline at end of file
+}
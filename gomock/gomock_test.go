@@ -19,7 +19,7 @@ package gomock
  *   -package: 用于指定mock类源文件的包名。如果你没有设置这个选项，则包名由mock_和输入文件的包名级联而成
  *
  * 本例：
- *   mockgen -destination=./mocks/mock.go -package=mocks github.com/hq-cml/go-unittest/common StorageClient,Decoder
+ *   mockgen -destination=./mocks/mock.go -package=mocks github.com/hq-cml/go-unittest/common StorageClient,ContextStorageClient,AtomicStorageClient,Decoder,Codec
  *
  * 测试套路：
  *	 1. mock控制器生成
@@ -46,13 +46,18 @@ package gomock
  *
  */
 import (
+	"context"
 	"errors"
 	"github.com/agiledragon/gomonkey"
 	"github.com/golang/mock/gomock"
 	"github.com/hq-cml/go-unittest/common"
 	"github.com/hq-cml/go-unittest/gomock/mocks"
 	"github.com/smartystreets/goconvey/convey"
+	"reflect"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCheckItemKey1(t *testing.T) {
@@ -258,6 +263,442 @@ func TestReplace(t *testing.T) {
 	}
 }
 
+//错误可以通过errors.Is判断类别，通过errors.As取出细节，不必比较字符串
+func TestTypedErrors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockCli := mocks.NewMockStorageClient(mockCtrl)
+	gomock.InOrder(
+		mockCli.EXPECT().Get("key1").Return("", false),
+		mockCli.EXPECT().Get("key1").Return("fuck", true),
+		//Replace: Get未命中，Set成功，再Get时已经被别人改掉
+		mockCli.EXPECT().Get("key2").Return("", false),
+		mockCli.EXPECT().Set("key2", "Hello").Return(nil),
+		mockCli.EXPECT().Get("key2").Return("World", true),
+		//Replace: Set之后读不到
+		mockCli.EXPECT().Get("key3").Return("", false),
+		mockCli.EXPECT().Set("key3", "Hello").Return(nil),
+		mockCli.EXPECT().Get("key3").Return("", false),
+	)
+
+	tests := []struct {
+		name     string
+		call     func() error
+		errIs    error
+		mismatch *common.ValueMismatchError
+	}{
+		{
+			name:  "CheckItemKey1 not found",
+			call:  func() error { _, err := CheckItemKey1(mockCli, "key1"); return err },
+			errIs: common.ErrNotFound,
+		},
+		{
+			name:     "CheckItemKey1 mismatch",
+			call:     func() error { _, err := CheckItemKey1(mockCli, "key1"); return err },
+			errIs:    common.ErrValueMismatch,
+			mismatch: &common.ValueMismatchError{Key: "key1", Expected: "Hello world", Actual: "fuck"},
+		},
+		{
+			name:     "Replace mismatch",
+			call:     func() error { _, err := Replace(mockCli, "key2", "Hello"); return err },
+			errIs:    common.ErrValueMismatch,
+			mismatch: &common.ValueMismatchError{Key: "key2", Expected: "Hello", Actual: "World"},
+		},
+		{
+			name:  "Replace not found",
+			call:  func() error { _, err := Replace(mockCli, "key3", "Hello"); return err },
+			errIs: common.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if !errors.Is(err, tt.errIs) {
+				t.Errorf("error = %v, want errors.Is %v", err, tt.errIs)
+			}
+			if tt.mismatch == nil {
+				return
+			}
+			var me *common.ValueMismatchError
+			if !errors.As(err, &me) {
+				t.Fatalf("error = %v, want *common.ValueMismatchError", err)
+			}
+			if *me != *tt.mismatch {
+				t.Errorf("error = %+v, want %+v", me, tt.mismatch)
+			}
+		})
+	}
+}
+
+//client支持原子操作时，Replace只调用一次GetOrSet
+func TestReplaceAtomic(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockCli := mocks.NewMockAtomicStorageClient(mockCtrl)
+	//没有对Get、Set注入行为，一旦被调用测试就会失败
+	gomock.InOrder(
+		mockCli.EXPECT().GetOrSet("key1", "Hello").Return("Hello", false, nil),
+		mockCli.EXPECT().GetOrSet("key1", "World").Return("Hello", true, nil),
+		mockCli.EXPECT().GetOrSet("key2", "Hello").Return("", false, errors.New("boom")),
+	)
+
+	tests := []struct {
+		name    string
+		key     string
+		def     string
+		want    string
+		wantErr bool
+	}{
+		{name: "case1", key: "key1", def: "Hello", want: "Hello", wantErr: false},
+		{name: "case2", key: "key1", def: "World", want: "Hello", wantErr: false},
+		{name: "case3", key: "key2", def: "Hello", want: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Replace(mockCli, tt.key, tt.def)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Replace() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Replace() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//装饰器没有实现AtomicStorageClient，包装RealClient之后Replace退化成Get->Set->Get
+func TestReplaceWrappedAtomic(t *testing.T) {
+	inner := common.NewRealClient()
+	wrapped := []common.StorageClient{
+		common.NewInstrumentedClient(inner),
+		common.NewRetryClient(inner, common.RetryConfig{}),
+		common.NewFaultClient(inner, common.FaultConfig{}),
+		common.NewRecordingClient(inner),
+	}
+	for _, c := range wrapped {
+		if _, ok := c.(common.AtomicStorageClient); ok {
+			t.Errorf("%T implements AtomicStorageClient, update the Replace documentation", c)
+		}
+	}
+
+	rec := common.NewRecordingClient(inner)
+	got, err := Replace(rec, "key1", "Hello")
+	if err != nil || got != "Hello" {
+		t.Fatalf("Replace() = %v, %v, want Hello, nil", got, err)
+	}
+	var methods []string
+	for _, in := range rec.Cassette().Interactions {
+		methods = append(methods, in.Method)
+	}
+	if want := []string{"Get", "Set", "Get"}; !reflect.DeepEqual(methods, want) {
+		t.Errorf("Replace() on a wrapped RealClient called %v, want %v", methods, want)
+	}
+}
+
+//用FaultClient按key注入故障，覆盖Replace的各个错误分支，不必为每个分支手写EXPECT
+func TestReplaceFault(t *testing.T) {
+	clock := common.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	inner := common.NewRealClient()
+	client := common.NewFaultClient(inner, common.FaultConfig{
+		Seed: 1,
+		Rules: []common.FaultRule{
+			{Prefix: "err:", ErrorRate: 1},
+			{Prefix: "drop:", DropWriteRate: 1},
+			{Prefix: "stale:", StaleReadRate: 1},
+			{Prefix: "slow:", Latency: time.Second},
+		},
+		Sleep: clock.Sleep,
+	})
+	inner.Set("stale:key1", "Old")
+	client.Delete("stale:key1")
+
+	tests := []struct {
+		name    string
+		key     string
+		def     string
+		want    string
+		wantErr bool
+	}{
+		{name: "normal", key: "key1", def: "Hello", want: "Hello", wantErr: false},
+		{name: "set error", key: "err:key1", def: "Hello", want: "", wantErr: true},
+		{name: "write dropped", key: "drop:key1", def: "Hello", want: "", wantErr: true},
+		{name: "stale read", key: "stale:key1", def: "Hello", want: "Old", wantErr: false},
+		{name: "slow", key: "slow:key1", def: "Hello", want: "Hello", wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Replace(client, tt.key, tt.def)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Replace() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Replace() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	//slow:key1经过了Get、Set、Get三次调用
+	if got := clock.Now().Sub(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)); got != 3*time.Second {
+		t.Errorf("injected latency = %v, want %v", got, 3*time.Second)
+	}
+}
+
+//大量goroutine同时对同一个key调用Replace，所有人拿到的都是同一个值
+func TestReplaceConcurrent(t *testing.T) {
+	client := common.NewRealClient()
+	const n = 100
+
+	var wg sync.WaitGroup
+	results := make([]string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := Replace(client, "key1", "def-"+strconv.Itoa(i))
+			if err != nil {
+				t.Errorf("Replace() error = %v", err)
+			}
+			results[i] = v
+		}(i)
+	}
+	wg.Wait()
+
+	stored, _ := client.Get("key1")
+	for i, v := range results {
+		if v != stored {
+			t.Errorf("goroutine %d got %v, stored %v", i, v, stored)
+		}
+	}
+}
+
+//启动进程内的假Redis，返回连接它的client
+func startRESP(t *testing.T) (*common.RESPServer, *common.RESPClient) {
+	server, err := common.StartRESPServer("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatalf("StartRESPServer() error = %v", err)
+	}
+	client, err := common.NewRESPStorageClient(server.Addr())
+	if err != nil {
+		server.Close()
+		t.Fatalf("NewRESPStorageClient() error = %v", err)
+	}
+	return server, client
+}
+
+//不用mock，直接跑在RESP协议的client上，服务端是进程内的假Redis
+func TestCheckItemKey1RESP(t *testing.T) {
+	server, client := startRESP(t)
+	defer server.Close()
+	defer client.Close()
+
+	tests := []struct {
+		name    string
+		prepare func()
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:    "case1",
+			prepare: func() {},
+			want:    false,
+			wantErr: true,
+		},
+		{
+			name:    "case2",
+			prepare: func() { client.Set("what ever", "fuck") },
+			want:    false,
+			wantErr: true,
+		},
+		{
+			name:    "case3",
+			prepare: func() { client.Set("what ever", "Hello world") },
+			want:    true,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prepare()
+			got, err := CheckItemKey1(client, "what ever")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckItemKey1() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("CheckItemKey1() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceRESP(t *testing.T) {
+	server, client := startRESP(t)
+	defer server.Close()
+	defer client.Close()
+
+	tests := []struct {
+		name    string
+		key     string
+		def     string
+		want    string
+		wantErr bool
+	}{
+		{name: "case1", key: "key1", def: "Hello", want: "Hello", wantErr: false},
+		{name: "case2", key: "key1", def: "World", want: "Hello", wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Replace(client, tt.key, tt.def)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Replace() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Replace() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	//服务端不可用
+	server.Close()
+	if _, err := Replace(client, "key2", "Hello"); err == nil {
+		t.Errorf("Replace() should fail when server is down")
+	}
+}
+
+//context版本，mock对象同样需要响应ctx的取消
+func TestCheckItemKey1Context(t *testing.T) {
+	convey.Convey("TestCheckItemKey1Context", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		convey.Convey("mock context client", func() {
+			mockCli := mocks.NewMockContextStorageClient(ctrl)
+			mockCli.EXPECT().GetContext(gomock.Any(), "key1").Return("Hello world", true, nil)
+
+			ok, err := CheckItemKey1Context(context.Background(), mockCli, "key1")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(ok, convey.ShouldBeTrue)
+		})
+
+		convey.Convey("mock context client blocks until deadline", func() {
+			mockCli := mocks.NewMockContextStorageClient(ctrl)
+			//用DoAndReturn让mock对象阻塞到ctx结束，并返回ctx.Err()
+			mockCli.EXPECT().GetContext(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, _ string) (string, bool, error) {
+					<-ctx.Done()
+					return "", false, ctx.Err()
+				})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			ok, err := CheckItemKey1Context(ctx, mockCli, "key1")
+			convey.So(errors.Is(err, context.DeadlineExceeded), convey.ShouldBeTrue)
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("plain mock wrapped by adapter", func() {
+			mockCli := mocks.NewMockStorageClient(ctrl)
+			//老接口的mock不认识ctx，由适配器负责在超时后返回
+			//Get阻塞到release被关闭，返回后关闭done
+			release := make(chan struct{})
+			done := make(chan struct{})
+			mockCli.EXPECT().Get(gomock.Any()).DoAndReturn(func(_ string) (string, bool) {
+				defer close(done)
+				<-release
+				return "Hello world", true
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			ok, err := CheckItemKey1Context(ctx, common.NewContextClient(mockCli), "key1")
+			convey.So(errors.Is(err, context.DeadlineExceeded), convey.ShouldBeTrue)
+			convey.So(ok, convey.ShouldBeFalse)
+			//放行并等mock的调用结束，否则ctrl.Finish时调用还没有发生
+			close(release)
+			<-done
+		})
+
+		convey.Convey("canceled before call", func() {
+			mockCli := mocks.NewMockContextStorageClient(ctrl)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			mockCli.EXPECT().GetContext(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, _ string) (string, bool, error) {
+					return "", false, ctx.Err()
+				})
+			_, err := CheckItemKey1Context(ctx, mockCli, "key1")
+			convey.So(errors.Is(err, context.Canceled), convey.ShouldBeTrue)
+		})
+	})
+}
+
+func TestReplaceContext(t *testing.T) {
+	convey.Convey("TestReplaceContext", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		convey.Convey("in order", func() {
+			mockCli := mocks.NewMockContextStorageClient(ctrl)
+			gomock.InOrder(
+				mockCli.EXPECT().GetContext(gomock.Any(), "key1").Return("", false, nil),
+				mockCli.EXPECT().SetContext(gomock.Any(), "key1", "Hello").Return(nil),
+				mockCli.EXPECT().GetContext(gomock.Any(), "key1").Return("Hello", true, nil),
+			)
+			v, err := ReplaceContext(context.Background(), mockCli, "key1", "Hello")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(v, convey.ShouldEqual, "Hello")
+		})
+
+		convey.Convey("stop after set timeout", func() {
+			mockCli := mocks.NewMockContextStorageClient(ctrl)
+			gomock.InOrder(
+				mockCli.EXPECT().GetContext(gomock.Any(), "key1").Return("", false, nil),
+				mockCli.EXPECT().SetContext(gomock.Any(), "key1", "Hello").Return(context.DeadlineExceeded),
+			)
+			_, err := ReplaceContext(context.Background(), mockCli, "key1", "Hello")
+			convey.So(errors.Is(err, context.DeadlineExceeded), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("atomic client honours ctx", func() {
+			//同时实现ContextStorageClient和AtomicStorageClient，GetOrSet阻塞到release被关闭
+			mockAtomic := mocks.NewMockAtomicStorageClient(ctrl)
+			client := struct {
+				*mocks.MockAtomicStorageClient
+				common.ContextStorageClient
+			}{mockAtomic, mocks.NewMockContextStorageClient(ctrl)}
+			release := make(chan struct{})
+			defer close(release)
+			mockAtomic.EXPECT().GetOrSet("key1", "Hello").DoAndReturn(func(_, def string) (string, bool, error) {
+				<-release
+				return def, false, nil
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err := ReplaceContext(ctx, client, "key1", "Hello")
+			convey.So(errors.Is(err, context.DeadlineExceeded), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("real client", func() {
+			client := common.NewRealClient()
+			v, err := ReplaceContext(context.Background(), client, "key1", "Hello")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(v, convey.ShouldEqual, "Hello")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err = ReplaceContext(ctx, client, "key1", "Hello")
+			convey.So(errors.Is(err, context.Canceled), convey.ShouldBeTrue)
+		})
+	})
+}
+
 //利用DoAndReturn来mock更加复杂的方法逻辑
 func TestDoAndReturn(t *testing.T) {
 	convey.Convey("TestDoAndReturn", t, func() {
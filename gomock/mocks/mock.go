@@ -1,10 +1,11 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/hq-cml/go-unittest/common (interfaces: StorageClient,Decoder)
+// Source: github.com/hq-cml/go-unittest/common (interfaces: StorageClient,ContextStorageClient,AtomicStorageClient,Decoder,Codec)
 
 // Package mocks is a generated GoMock package.
 package mocks
 
 import (
+	context "context"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
 )
@@ -32,6 +33,34 @@ func (m *MockStorageClient) EXPECT() *MockStorageClientMockRecorder {
 	return m.recorder
 }
 
+// Delete mocks base method
+func (m *MockStorageClient) Delete(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockStorageClientMockRecorder) Delete(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockStorageClient)(nil).Delete), arg0)
+}
+
+// Exists mocks base method
+func (m *MockStorageClient) Exists(arg0 string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Exists", arg0)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Exists indicates an expected call of Exists
+func (mr *MockStorageClientMockRecorder) Exists(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockStorageClient)(nil).Exists), arg0)
+}
+
 // Get mocks base method
 func (m *MockStorageClient) Get(arg0 string) (string, bool) {
 	m.ctrl.T.Helper()
@@ -47,6 +76,37 @@ func (mr *MockStorageClientMockRecorder) Get(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStorageClient)(nil).Get), arg0)
 }
 
+// Keys mocks base method
+func (m *MockStorageClient) Keys() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Keys")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Keys indicates an expected call of Keys
+func (mr *MockStorageClientMockRecorder) Keys() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Keys", reflect.TypeOf((*MockStorageClient)(nil).Keys))
+}
+
+// Scan mocks base method
+func (m *MockStorageClient) Scan(arg0, arg1 string, arg2 int) ([]string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Scan", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Scan indicates an expected call of Scan
+func (mr *MockStorageClientMockRecorder) Scan(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Scan", reflect.TypeOf((*MockStorageClient)(nil).Scan), arg0, arg1, arg2)
+}
+
 // Set mocks base method
 func (m *MockStorageClient) Set(arg0, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -61,6 +121,294 @@ func (mr *MockStorageClientMockRecorder) Set(arg0, arg1 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockStorageClient)(nil).Set), arg0, arg1)
 }
 
+// MockContextStorageClient is a mock of ContextStorageClient interface
+type MockContextStorageClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockContextStorageClientMockRecorder
+}
+
+// MockContextStorageClientMockRecorder is the mock recorder for MockContextStorageClient
+type MockContextStorageClientMockRecorder struct {
+	mock *MockContextStorageClient
+}
+
+// NewMockContextStorageClient creates a new mock instance
+func NewMockContextStorageClient(ctrl *gomock.Controller) *MockContextStorageClient {
+	mock := &MockContextStorageClient{ctrl: ctrl}
+	mock.recorder = &MockContextStorageClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockContextStorageClient) EXPECT() *MockContextStorageClientMockRecorder {
+	return m.recorder
+}
+
+// DeleteContext mocks base method
+func (m *MockContextStorageClient) DeleteContext(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteContext", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteContext indicates an expected call of DeleteContext
+func (mr *MockContextStorageClientMockRecorder) DeleteContext(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteContext", reflect.TypeOf((*MockContextStorageClient)(nil).DeleteContext), arg0, arg1)
+}
+
+// ExistsContext mocks base method
+func (m *MockContextStorageClient) ExistsContext(arg0 context.Context, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExistsContext", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExistsContext indicates an expected call of ExistsContext
+func (mr *MockContextStorageClientMockRecorder) ExistsContext(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExistsContext", reflect.TypeOf((*MockContextStorageClient)(nil).ExistsContext), arg0, arg1)
+}
+
+// GetContext mocks base method
+func (m *MockContextStorageClient) GetContext(arg0 context.Context, arg1 string) (string, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetContext", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetContext indicates an expected call of GetContext
+func (mr *MockContextStorageClientMockRecorder) GetContext(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContext", reflect.TypeOf((*MockContextStorageClient)(nil).GetContext), arg0, arg1)
+}
+
+// KeysContext mocks base method
+func (m *MockContextStorageClient) KeysContext(arg0 context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "KeysContext", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// KeysContext indicates an expected call of KeysContext
+func (mr *MockContextStorageClientMockRecorder) KeysContext(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "KeysContext", reflect.TypeOf((*MockContextStorageClient)(nil).KeysContext), arg0)
+}
+
+// ScanContext mocks base method
+func (m *MockContextStorageClient) ScanContext(arg0 context.Context, arg1, arg2 string, arg3 int) ([]string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScanContext", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ScanContext indicates an expected call of ScanContext
+func (mr *MockContextStorageClientMockRecorder) ScanContext(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScanContext", reflect.TypeOf((*MockContextStorageClient)(nil).ScanContext), arg0, arg1, arg2, arg3)
+}
+
+// SetContext mocks base method
+func (m *MockContextStorageClient) SetContext(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetContext", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetContext indicates an expected call of SetContext
+func (mr *MockContextStorageClientMockRecorder) SetContext(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetContext", reflect.TypeOf((*MockContextStorageClient)(nil).SetContext), arg0, arg1, arg2)
+}
+
+// MockAtomicStorageClient is a mock of AtomicStorageClient interface
+type MockAtomicStorageClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockAtomicStorageClientMockRecorder
+}
+
+// MockAtomicStorageClientMockRecorder is the mock recorder for MockAtomicStorageClient
+type MockAtomicStorageClientMockRecorder struct {
+	mock *MockAtomicStorageClient
+}
+
+// NewMockAtomicStorageClient creates a new mock instance
+func NewMockAtomicStorageClient(ctrl *gomock.Controller) *MockAtomicStorageClient {
+	mock := &MockAtomicStorageClient{ctrl: ctrl}
+	mock.recorder = &MockAtomicStorageClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockAtomicStorageClient) EXPECT() *MockAtomicStorageClientMockRecorder {
+	return m.recorder
+}
+
+// CompareAndSwap mocks base method
+func (m *MockAtomicStorageClient) CompareAndSwap(arg0, arg1, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompareAndSwap", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompareAndSwap indicates an expected call of CompareAndSwap
+func (mr *MockAtomicStorageClientMockRecorder) CompareAndSwap(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareAndSwap", reflect.TypeOf((*MockAtomicStorageClient)(nil).CompareAndSwap), arg0, arg1, arg2)
+}
+
+// Delete mocks base method
+func (m *MockAtomicStorageClient) Delete(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockAtomicStorageClientMockRecorder) Delete(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockAtomicStorageClient)(nil).Delete), arg0)
+}
+
+// Exists mocks base method
+func (m *MockAtomicStorageClient) Exists(arg0 string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Exists", arg0)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Exists indicates an expected call of Exists
+func (mr *MockAtomicStorageClientMockRecorder) Exists(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockAtomicStorageClient)(nil).Exists), arg0)
+}
+
+// Get mocks base method
+func (m *MockAtomicStorageClient) Get(arg0 string) (string, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", arg0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get
+func (mr *MockAtomicStorageClientMockRecorder) Get(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockAtomicStorageClient)(nil).Get), arg0)
+}
+
+// GetOrSet mocks base method
+func (m *MockAtomicStorageClient) GetOrSet(arg0, arg1 string) (string, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrSet", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetOrSet indicates an expected call of GetOrSet
+func (mr *MockAtomicStorageClientMockRecorder) GetOrSet(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrSet", reflect.TypeOf((*MockAtomicStorageClient)(nil).GetOrSet), arg0, arg1)
+}
+
+// Keys mocks base method
+func (m *MockAtomicStorageClient) Keys() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Keys")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Keys indicates an expected call of Keys
+func (mr *MockAtomicStorageClientMockRecorder) Keys() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Keys", reflect.TypeOf((*MockAtomicStorageClient)(nil).Keys))
+}
+
+// MGet mocks base method
+func (m *MockAtomicStorageClient) MGet(arg0 ...string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range arg0 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "MGet", varargs...)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MGet indicates an expected call of MGet
+func (mr *MockAtomicStorageClientMockRecorder) MGet(arg0 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MGet", reflect.TypeOf((*MockAtomicStorageClient)(nil).MGet), arg0...)
+}
+
+// MSet mocks base method
+func (m *MockAtomicStorageClient) MSet(arg0 map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MSet", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MSet indicates an expected call of MSet
+func (mr *MockAtomicStorageClientMockRecorder) MSet(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MSet", reflect.TypeOf((*MockAtomicStorageClient)(nil).MSet), arg0)
+}
+
+// Scan mocks base method
+func (m *MockAtomicStorageClient) Scan(arg0, arg1 string, arg2 int) ([]string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Scan", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Scan indicates an expected call of Scan
+func (mr *MockAtomicStorageClientMockRecorder) Scan(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Scan", reflect.TypeOf((*MockAtomicStorageClient)(nil).Scan), arg0, arg1, arg2)
+}
+
+// Set mocks base method
+func (m *MockAtomicStorageClient) Set(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Set", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Set indicates an expected call of Set
+func (mr *MockAtomicStorageClientMockRecorder) Set(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockAtomicStorageClient)(nil).Set), arg0, arg1)
+}
+
 // MockDecoder is a mock of Decoder interface
 type MockDecoder struct {
 	ctrl     *gomock.Controller
@@ -97,3 +445,55 @@ func (mr *MockDecoderMockRecorder) Unmarshal(arg0, arg1 interface{}) *gomock.Cal
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unmarshal", reflect.TypeOf((*MockDecoder)(nil).Unmarshal), arg0, arg1)
 }
+
+// MockCodec is a mock of Codec interface
+type MockCodec struct {
+	ctrl     *gomock.Controller
+	recorder *MockCodecMockRecorder
+}
+
+// MockCodecMockRecorder is the mock recorder for MockCodec
+type MockCodecMockRecorder struct {
+	mock *MockCodec
+}
+
+// NewMockCodec creates a new mock instance
+func NewMockCodec(ctrl *gomock.Controller) *MockCodec {
+	mock := &MockCodec{ctrl: ctrl}
+	mock.recorder = &MockCodecMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockCodec) EXPECT() *MockCodecMockRecorder {
+	return m.recorder
+}
+
+// Marshal mocks base method
+func (m *MockCodec) Marshal(arg0 interface{}) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Marshal", arg0)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Marshal indicates an expected call of Marshal
+func (mr *MockCodecMockRecorder) Marshal(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Marshal", reflect.TypeOf((*MockCodec)(nil).Marshal), arg0)
+}
+
+// Unmarshal mocks base method
+func (m *MockCodec) Unmarshal(arg0 []byte, arg1 interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unmarshal", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unmarshal indicates an expected call of Unmarshal
+func (mr *MockCodecMockRecorder) Unmarshal(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unmarshal", reflect.TypeOf((*MockCodec)(nil).Unmarshal), arg0, arg1)
+}
@@ -0,0 +1,212 @@
+package gosqlmock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/hq-cml/go-unittest/common"
+)
+
+/*
+ * 基于database/sql的存储，SQL使用SQLite语法(?占位符，INSERT ... ON CONFLICT)
+ * 需要的表：
+ *   CREATE TABLE kv (k TEXT PRIMARY KEY, v TEXT NOT NULL);
+ *   CREATE TABLE movies (name TEXT PRIMARY KEY, type TEXT NOT NULL, score INTEGER NOT NULL);
+ */
+
+//用关系型数据库的kv表实现StorageClient
+type SQLClient struct {
+	db *sql.DB
+}
+
+func NewSQLStorageClient(db *sql.DB) *SQLClient {
+	return &SQLClient{db: db}
+}
+
+func (c *SQLClient) Get(k string) (string, bool) {
+	var v string
+	err := c.db.QueryRow("SELECT v FROM kv WHERE k = ?", k).Scan(&v)
+	if err != nil {
+		//sql.ErrNoRows即不存在，其他错误也只能按不存在处理
+		return "", false
+	}
+	return v, true
+}
+
+func (c *SQLClient) Set(k, v string) error {
+	_, err := c.db.Exec("INSERT INTO kv (k, v) VALUES (?, ?) ON CONFLICT (k) DO UPDATE SET v = excluded.v", k, v)
+	return wrapErr(err)
+}
+
+func (c *SQLClient) Delete(k string) error {
+	_, err := c.db.Exec("DELETE FROM kv WHERE k = ?", k)
+	return wrapErr(err)
+}
+
+func (c *SQLClient) Exists(k string) bool {
+	var one int
+	return c.db.QueryRow("SELECT 1 FROM kv WHERE k = ?", k).Scan(&one) == nil
+}
+
+func (c *SQLClient) Keys() ([]string, error) {
+	keys, _, err := c.Scan("", "", 0)
+	return keys, err
+}
+
+//cursor的含义和RealClient相同：上一批最后一个key末尾补\x00，本批从不小于cursor的key开始
+//多查一行用来判断是否还有下一批
+//前缀用substr精确比较，不能用LIKE：SQLite的LIKE对ASCII字母不区分大小写，"movie:"会匹配到"MOVIE:1"
+func (c *SQLClient) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	query := `SELECT k FROM kv WHERE k >= ? AND substr(k, 1, length(?)) = ? ORDER BY k`
+	args := []interface{}{cursor, prefix, prefix}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit+1)
+	}
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, "", wrapErr(err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, "", err
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		next = keys[limit-1] + "\x00"
+	}
+	return keys, next, nil
+}
+
+//连接类的错误包装成*common.UnavailableError，其他错误原样返回
+func wrapErr(err error) error {
+	if err == driver.ErrBadConn || err == sql.ErrConnDone {
+		return &common.UnavailableError{Backend: "sql", Err: err}
+	}
+	return err
+}
+
+//movies表的读写
+type MovieRepository struct {
+	db *sql.DB
+}
+
+func NewMovieRepository(db *sql.DB) *MovieRepository {
+	return &MovieRepository{db: db}
+}
+
+//按名字查询，不存在返回*common.NotFoundError
+func (r *MovieRepository) Get(ctx context.Context, name string) (*common.Movie, error) {
+	m := &common.Movie{}
+	err := r.db.QueryRowContext(ctx, "SELECT name, type, score FROM movies WHERE name = ?", name).
+		Scan(&m.Name, &m.Type, &m.Score)
+	if err == sql.ErrNoRows {
+		return nil, &common.NotFoundError{Key: name}
+	}
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	return m, nil
+}
+
+//新增一部电影
+func (r *MovieRepository) Create(ctx context.Context, m *common.Movie) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO movies (name, type, score) VALUES (?, ?, ?)", m.Name, m.Type, m.Score)
+	return wrapErr(err)
+}
+
+//更新已有的电影，不存在返回*common.NotFoundError
+func (r *MovieRepository) Update(ctx context.Context, m *common.Movie) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE movies SET type = ?, score = ? WHERE name = ?", m.Type, m.Score, m.Name)
+	if err != nil {
+		return wrapErr(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return &common.NotFoundError{Key: m.Name}
+	}
+	return nil
+}
+
+//删除电影，不存在返回*common.NotFoundError
+func (r *MovieRepository) Delete(ctx context.Context, name string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM movies WHERE name = ?", name)
+	if err != nil {
+		return wrapErr(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return &common.NotFoundError{Key: name}
+	}
+	return nil
+}
+
+//按类型列出电影，按分数从高到低排列，typ为空时列出全部
+func (r *MovieRepository) List(ctx context.Context, typ string) ([]*common.Movie, error) {
+	query := "SELECT name, type, score FROM movies ORDER BY score DESC, name"
+	var args []interface{}
+	if typ != "" {
+		query = "SELECT name, type, score FROM movies WHERE type = ? ORDER BY score DESC, name"
+		args = append(args, typ)
+	}
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, wrapErr(err)
+	}
+	defer rows.Close()
+
+	var movies []*common.Movie
+	for rows.Next() {
+		m := &common.Movie{}
+		if err := rows.Scan(&m.Name, &m.Type, &m.Score); err != nil {
+			return nil, err
+		}
+		movies = append(movies, m)
+	}
+	return movies, rows.Err()
+}
+
+//在一个事务里批量写入，已存在的覆盖，任何一条失败则全部回滚
+func (r *MovieRepository) SaveAll(ctx context.Context, movies []*common.Movie) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr(err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO movies (name, type, score) VALUES (?, ?, ?) "+
+		"ON CONFLICT (name) DO UPDATE SET type = excluded.type, score = excluded.score")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, m := range movies {
+		if _, err = stmt.ExecContext(ctx, m.Name, m.Type, m.Score); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,326 @@
+package gosqlmock
+
+/*
+ * go-sqlmock实现了一个database/sql/driver，用来在单测中模拟数据库，不需要真实的db
+ *   db, mock, err := sqlmock.New()
+ *   得到的db就是普通的*sql.DB，注入到被测代码中，mock用来注入期望
+ *
+ * 期望：
+ *   mock.ExpectQuery(sql) / mock.ExpectExec(sql)：期望执行的SQL，默认按正则匹配，所以需要regexp.QuoteMeta转义
+ *      .WithArgs(...)：期望的参数，sqlmock.AnyArg()匹配任意值
+ *      .WillReturnRows(sqlmock.NewRows(columns).AddRow(...))：查询返回的数据
+ *      .WillReturnResult(sqlmock.NewResult(lastInsertID, rowsAffected))：执行的结果
+ *      .WillReturnError(err)：返回错误
+ *   mock.ExpectBegin() / ExpectCommit() / ExpectRollback() / ExpectPrepare()：事务和预编译
+ *   默认按注册顺序严格匹配，可以用mock.MatchExpectationsInOrder(false)关闭
+ *
+ * 测试结束时调用mock.ExpectationsWereMet()，检查是否所有期望都被执行了
+ */
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hq-cml/go-unittest/common"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func newMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	return db, mock
+}
+
+func TestSQLClient(t *testing.T) {
+	convey.Convey("TestSQLClient", t, func() {
+		db, mock := newMock(t)
+		defer db.Close()
+		client := NewSQLStorageClient(db)
+
+		convey.Convey("get", func() {
+			getSQL := regexp.QuoteMeta("SELECT v FROM kv WHERE k = ?")
+			mock.ExpectQuery(getSQL).WithArgs("k1").
+				WillReturnRows(sqlmock.NewRows([]string{"v"}).AddRow("v1"))
+			mock.ExpectQuery(getSQL).WithArgs("missing").
+				WillReturnRows(sqlmock.NewRows([]string{"v"}))
+			mock.ExpectQuery(getSQL).WithArgs("k2").
+				WillReturnError(errors.New("connection reset"))
+
+			v, ok := client.Get("k1")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(v, convey.ShouldEqual, "v1")
+			//sql.ErrNoRows按不存在处理
+			v, ok = client.Get("missing")
+			convey.So(ok, convey.ShouldBeFalse)
+			convey.So(v, convey.ShouldEqual, "")
+			_, ok = client.Get("k2")
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("connection lost", func() {
+			mock.ExpectExec("INSERT INTO kv").WillReturnError(sql.ErrConnDone)
+			err := client.Set("k1", "v1")
+			convey.So(errors.Is(err, common.ErrBackendUnavailable), convey.ShouldBeTrue)
+			convey.So(errors.Is(err, sql.ErrConnDone), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("set and delete", func() {
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO kv (k, v) VALUES (?, ?) ON CONFLICT (k) DO UPDATE SET v = excluded.v")).
+				WithArgs("k1", "v1").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM kv WHERE k = ?")).
+				WithArgs("k1").
+				WillReturnError(errors.New("disk full"))
+
+			convey.So(client.Set("k1", "v1"), convey.ShouldBeNil)
+			convey.So(client.Delete("k1"), convey.ShouldBeError, "disk full")
+		})
+
+		convey.Convey("exists", func() {
+			existsSQL := regexp.QuoteMeta("SELECT 1 FROM kv WHERE k = ?")
+			mock.ExpectQuery(existsSQL).WithArgs("k1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+			mock.ExpectQuery(existsSQL).WithArgs("k2").WillReturnRows(sqlmock.NewRows([]string{"1"}))
+
+			convey.So(client.Exists("k1"), convey.ShouldBeTrue)
+			convey.So(client.Exists("k2"), convey.ShouldBeFalse)
+		})
+
+		convey.Convey("scan", func() {
+			scanSQL := regexp.QuoteMeta(`SELECT k FROM kv WHERE k >= ? AND substr(k, 1, length(?)) = ? ORDER BY k LIMIT ?`)
+			//多查一行，用来判断还有没有下一批
+			mock.ExpectQuery(scanSQL).WithArgs("", "movie_", "movie_", 3).
+				WillReturnRows(sqlmock.NewRows([]string{"k"}).AddRow("movie_1").AddRow("movie_2").AddRow("movie_3"))
+			mock.ExpectQuery(scanSQL).WithArgs("movie_2\x00", "movie_", "movie_", 3).
+				WillReturnRows(sqlmock.NewRows([]string{"k"}).AddRow("movie_3"))
+
+			keys, next, err := client.Scan("movie_", "", 2)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"movie_1", "movie_2"})
+			convey.So(next, convey.ShouldEqual, "movie_2\x00")
+
+			keys, next, err = client.Scan("movie_", next, 2)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"movie_3"})
+			convey.So(next, convey.ShouldEqual, "")
+		})
+
+		convey.Convey("scan prefix is case sensitive", func() {
+			//表中有movie:1、MOVIE:2、Movie:3、movie:4，前缀必须原样传给数据库精确比较，不能交给不区分大小写的LIKE
+			scanSQL := `SELECT k FROM kv WHERE k >= ? AND substr(k, 1, length(?)) = ? ORDER BY k`
+			mock.ExpectQuery(regexp.QuoteMeta(scanSQL)).WithArgs("", "movie:", "movie:").
+				WillReturnRows(sqlmock.NewRows([]string{"k"}).AddRow("movie:1").AddRow("movie:4"))
+			mock.ExpectQuery(regexp.QuoteMeta(scanSQL)).WithArgs("", "MOVIE:", "MOVIE:").
+				WillReturnRows(sqlmock.NewRows([]string{"k"}).AddRow("MOVIE:2"))
+
+			keys, _, err := client.Scan("movie:", "", 0)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"movie:1", "movie:4"})
+			keys, _, err = client.Scan("MOVIE:", "", 0)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"MOVIE:2"})
+		})
+
+		convey.Convey("keys", func() {
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT k FROM kv WHERE k >= ? AND substr(k, 1, length(?)) = ? ORDER BY k`)).
+				WithArgs("", "", "").
+				WillReturnRows(sqlmock.NewRows([]string{"k"}).AddRow("a").AddRow("b").RowError(1, errors.New("read timeout")))
+
+			_, err := client.Keys()
+			convey.So(err, convey.ShouldBeError, "read timeout")
+		})
+
+		convey.So(mock.ExpectationsWereMet(), convey.ShouldBeNil)
+	})
+}
+
+func TestMovieRepositoryGet(t *testing.T) {
+	db, mock := newMock(t)
+	defer db.Close()
+	repo := NewMovieRepository(db)
+
+	getSQL := regexp.QuoteMeta("SELECT name, type, score FROM movies WHERE name = ?")
+	columns := []string{"name", "type", "score"}
+	mock.ExpectQuery(getSQL).WithArgs("Alien").WillReturnRows(sqlmock.NewRows(columns).AddRow("Alien", "SciFi", 9))
+	mock.ExpectQuery(getSQL).WithArgs("Nope").WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectQuery(getSQL).WithArgs("Broken").WillReturnError(sql.ErrConnDone)
+	mock.ExpectQuery(getSQL).WithArgs("BadRow").WillReturnRows(sqlmock.NewRows(columns).AddRow("BadRow", "Drama", "ten"))
+
+	tests := []struct {
+		name    string
+		movie   string
+		want    *common.Movie
+		wantErr bool
+		errIs   error //不为nil时要求errors.Is(err, errIs)
+	}{
+		{name: "found", movie: "Alien", want: &common.Movie{Name: "Alien", Type: "SciFi", Score: 9}},
+		{name: "not found", movie: "Nope", wantErr: true, errIs: common.ErrNotFound},
+		{name: "db error", movie: "Broken", wantErr: true, errIs: common.ErrBackendUnavailable},
+		{name: "bad column", movie: "BadRow", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.Get(context.Background(), tt.movie)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+				t.Errorf("Get() error = %v, want %v", err, tt.errIs)
+			}
+			if tt.want != nil && (got == nil || *got != *tt.want) {
+				t.Errorf("Get() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("ExpectationsWereMet() error = %v", err)
+	}
+}
+
+func TestMovieRepositoryWrite(t *testing.T) {
+	convey.Convey("TestMovieRepositoryWrite", t, func() {
+		db, mock := newMock(t)
+		defer db.Close()
+		repo := NewMovieRepository(db)
+		ctx := context.Background()
+		alien := &common.Movie{Name: "Alien", Type: "SciFi", Score: 9}
+
+		convey.Convey("create", func() {
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO movies (name, type, score) VALUES (?, ?, ?)")).
+				WithArgs("Alien", "SciFi", 9).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			convey.So(repo.Create(ctx, alien), convey.ShouldBeNil)
+		})
+
+		convey.Convey("update", func() {
+			updateSQL := regexp.QuoteMeta("UPDATE movies SET type = ?, score = ? WHERE name = ?")
+			mock.ExpectExec(updateSQL).WithArgs("SciFi", 9, "Alien").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(updateSQL).WithArgs("SciFi", 9, "Alien").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(updateSQL).WithArgs("SciFi", 9, "Alien").
+				WillReturnResult(sqlmock.NewErrorResult(errors.New("rows affected not supported")))
+
+			convey.So(repo.Update(ctx, alien), convey.ShouldBeNil)
+			err := repo.Update(ctx, alien)
+			var nf *common.NotFoundError
+			convey.So(errors.As(err, &nf), convey.ShouldBeTrue)
+			convey.So(nf.Key, convey.ShouldEqual, "Alien")
+			convey.So(repo.Update(ctx, alien), convey.ShouldBeError, "rows affected not supported")
+		})
+
+		convey.Convey("delete", func() {
+			deleteSQL := regexp.QuoteMeta("DELETE FROM movies WHERE name = ?")
+			mock.ExpectExec(deleteSQL).WithArgs("Alien").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(deleteSQL).WithArgs("Alien").WillReturnResult(sqlmock.NewResult(0, 0))
+
+			convey.So(repo.Delete(ctx, "Alien"), convey.ShouldBeNil)
+			convey.So(errors.Is(repo.Delete(ctx, "Alien"), common.ErrNotFound), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("list", func() {
+			columns := []string{"name", "type", "score"}
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT name, type, score FROM movies WHERE type = ? ORDER BY score DESC, name")).
+				WithArgs("SciFi").
+				WillReturnRows(sqlmock.NewRows(columns).AddRow("Alien", "SciFi", 9).AddRow("Brazil", "SciFi", 8))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT name, type, score FROM movies ORDER BY score DESC, name")).
+				WillReturnRows(sqlmock.NewRows(columns))
+
+			movies, err := repo.List(ctx, "SciFi")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(movies, convey.ShouldResemble, []*common.Movie{alien, {Name: "Brazil", Type: "SciFi", Score: 8}})
+
+			movies, err = repo.List(ctx, "")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(movies, convey.ShouldBeEmpty)
+		})
+
+		convey.So(mock.ExpectationsWereMet(), convey.ShouldBeNil)
+	})
+}
+
+func TestMovieRepositorySaveAll(t *testing.T) {
+	movies := []*common.Movie{
+		{Name: "Alien", Type: "SciFi", Score: 9},
+		{Name: "Brazil", Type: "SciFi", Score: 8},
+	}
+	insertSQL := regexp.QuoteMeta("INSERT INTO movies (name, type, score) VALUES (?, ?, ?) " +
+		"ON CONFLICT (name) DO UPDATE SET type = excluded.type, score = excluded.score")
+
+	tests := []struct {
+		name    string
+		expect  func(mock sqlmock.Sqlmock)
+		wantErr string
+	}{
+		{
+			name: "commit",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				prep := mock.ExpectPrepare(insertSQL)
+				prep.ExpectExec().WithArgs("Alien", "SciFi", 9).WillReturnResult(sqlmock.NewResult(0, 1))
+				prep.ExpectExec().WithArgs("Brazil", "SciFi", 8).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "rollback on exec error",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				prep := mock.ExpectPrepare(insertSQL)
+				prep.ExpectExec().WithArgs("Alien", "SciFi", 9).WillReturnResult(sqlmock.NewResult(0, 1))
+				prep.ExpectExec().WithArgs("Brazil", "SciFi", 8).WillReturnError(errors.New("constraint failed"))
+				mock.ExpectRollback()
+			},
+			wantErr: "constraint failed",
+		},
+		{
+			name: "rollback on prepare error",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectPrepare(insertSQL).WillReturnError(errors.New("no such table: movies"))
+				mock.ExpectRollback()
+			},
+			wantErr: "no such table: movies",
+		},
+		{
+			name: "begin error",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin().WillReturnError(errors.New("too many connections"))
+			},
+			wantErr: "too many connections",
+		},
+		{
+			name: "commit error",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				prep := mock.ExpectPrepare(insertSQL)
+				prep.ExpectExec().WithArgs("Alien", "SciFi", 9).WillReturnResult(sqlmock.NewResult(0, 1))
+				prep.ExpectExec().WithArgs("Brazil", "SciFi", 8).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit().WillReturnError(errors.New("database is locked"))
+			},
+			wantErr: "database is locked",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newMock(t)
+			defer db.Close()
+			tt.expect(mock)
+
+			err := NewMovieRepository(db).SaveAll(context.Background(), movies)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("SaveAll() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("SaveAll() error = %v, want %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("ExpectationsWereMet() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package httptest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hq-cml/go-unittest/common"
+)
+
+/*
+ * 把StorageClient以REST的方式暴露出去：
+ *   GET    /kv/{key}                       200 {"key":"k","value":"v"}，不存在返回404
+ *   HEAD   /kv/{key}                       200，不存在返回404
+ *   PUT    /kv/{key}  body: {"value":"v"}  204
+ *   DELETE /kv/{key}                       204，不存在也返回204
+ *   GET    /kv?prefix=&cursor=&limit=      200 {"keys":[...],"next":""}，limit为空或0时一次返回全部
+ * key需要做path转义，可以包含"/"；value通过JSON传输，需要是合法的UTF-8
+ * 出错时返回对应的状态码，body为{"error":"..."}
+ */
+
+//body的大小上限
+const maxBodySize = 1 << 20
+
+//GET /kv/{key}的响应
+type Item struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+//PUT /kv/{key}的请求
+type PutRequest struct {
+	Value *string `json:"value"`
+}
+
+//GET /kv的响应
+type ListResponse struct {
+	Keys []string `json:"keys"`
+	Next string   `json:"next"`
+}
+
+//出错时的响应
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type handler struct {
+	c common.ContextStorageClient
+}
+
+//把c包装成http.Handler，c支持context时请求被取消会中断存储调用
+func NewHandler(c common.StorageClient) http.Handler {
+	return &handler{c: common.NewContextClient(c)}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	if path == "/kv" {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h.list(w, r)
+		return
+	}
+	if !strings.HasPrefix(path, "/kv/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	key, err := url.PathUnescape(strings.TrimPrefix(path, "/kv/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid key: "+err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r, key)
+	case http.MethodPut:
+		h.put(w, r, key)
+	case http.MethodDelete:
+		h.delete(w, r, key)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request, key string) {
+	v, ok, err := h.c.GetContext(r.Context(), key)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, Item{Key: key, Value: v})
+}
+
+func (h *handler) put(w http.ResponseWriter, r *http.Request, key string) {
+	var req PutRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	if dec.More() {
+		writeError(w, http.StatusBadRequest, "invalid body: trailing data")
+		return
+	}
+	if req.Value == nil {
+		writeError(w, http.StatusBadRequest, "invalid body: missing value")
+		return
+	}
+	if err := h.c.SetContext(r.Context(), key, *req.Value); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) delete(w http.ResponseWriter, r *http.Request, key string) {
+	if err := h.c.DeleteContext(r.Context(), key); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 0
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit: "+s)
+			return
+		}
+		limit = n
+	}
+	keys, next, err := h.c.ScanContext(r.Context(), q.Get("prefix"), q.Get("cursor"), limit)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+	writeJSON(w, http.StatusOK, ListResponse{Keys: keys, Next: next})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, ErrorResponse{Error: msg})
+}
+
+//存储返回的错误：ErrNotFound返回404，ErrBackendUnavailable返回503，ctx超时返回504，其他都是500
+func writeStorageError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, common.ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, common.ErrBackendUnavailable):
+		code = http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		code = http.StatusGatewayTimeout
+	}
+	writeError(w, code, err.Error())
+}
+
+//服务端返回的非预期状态码
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http storage: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+//404对应common.ErrNotFound，502、503、504对应common.ErrBackendUnavailable
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case common.ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case common.ErrBackendUnavailable:
+		return e.StatusCode == http.StatusBadGateway ||
+			e.StatusCode == http.StatusServiceUnavailable ||
+			e.StatusCode == http.StatusGatewayTimeout
+	}
+	return false
+}
+
+//通过HTTP访问NewHandler暴露的存储，同时实现了StorageClient和ContextStorageClient
+//Get、Exists出错时按不存在处理，需要区分时使用GetContext、ExistsContext
+//连接失败、超时返回*common.UnavailableError，服务端返回非预期的状态码时返回*StatusError
+type Client struct {
+	base string
+	hc   *http.Client
+}
+
+//Client的可选配置
+type Option func(*Client)
+
+//使用指定的http.Client，默认为http.DefaultClient，传nil同样使用http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		if hc == nil {
+			hc = http.DefaultClient
+		}
+		c.hc = hc
+	}
+}
+
+//每次请求的超时时间，默认不超时
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		hc := *c.hc
+		hc.Timeout = d
+		c.hc = &hc
+	}
+}
+
+//base为服务的根地址，例如http://127.0.0.1:8080
+func NewClient(base string, opts ...Option) *Client {
+	c := &Client{base: strings.TrimSuffix(base, "/"), hc: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Client) Get(k string) (string, bool) {
+	v, ok, _ := c.GetContext(context.Background(), k)
+	return v, ok
+}
+
+func (c *Client) Set(k, v string) error {
+	return c.SetContext(context.Background(), k, v)
+}
+
+func (c *Client) Delete(k string) error {
+	return c.DeleteContext(context.Background(), k)
+}
+
+func (c *Client) Exists(k string) bool {
+	ok, _ := c.ExistsContext(context.Background(), k)
+	return ok
+}
+
+func (c *Client) Keys() ([]string, error) {
+	return c.KeysContext(context.Background())
+}
+
+func (c *Client) Scan(prefix, cursor string, limit int) ([]string, string, error) {
+	return c.ScanContext(context.Background(), prefix, cursor, limit)
+}
+
+func (c *Client) GetContext(ctx context.Context, k string) (string, bool, error) {
+	var item Item
+	code, err := c.do(ctx, http.MethodGet, keyPath(k), nil, &item, http.StatusOK, http.StatusNotFound)
+	if err != nil || code == http.StatusNotFound {
+		return "", false, err
+	}
+	return item.Value, true, nil
+}
+
+func (c *Client) SetContext(ctx context.Context, k, v string) error {
+	body, err := json.Marshal(PutRequest{Value: &v})
+	if err != nil {
+		return err
+	}
+	_, err = c.do(ctx, http.MethodPut, keyPath(k), body, nil, http.StatusNoContent)
+	return err
+}
+
+func (c *Client) DeleteContext(ctx context.Context, k string) error {
+	_, err := c.do(ctx, http.MethodDelete, keyPath(k), nil, nil, http.StatusNoContent)
+	return err
+}
+
+func (c *Client) ExistsContext(ctx context.Context, k string) (bool, error) {
+	code, err := c.do(ctx, http.MethodHead, keyPath(k), nil, nil, http.StatusOK, http.StatusNotFound)
+	return err == nil && code == http.StatusOK, err
+}
+
+func (c *Client) KeysContext(ctx context.Context) ([]string, error) {
+	keys, _, err := c.ScanContext(ctx, "", "", 0)
+	return keys, err
+}
+
+func (c *Client) ScanContext(ctx context.Context, prefix, cursor string, limit int) ([]string, string, error) {
+	q := url.Values{}
+	q.Set("prefix", prefix)
+	q.Set("cursor", cursor)
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var resp ListResponse
+	if _, err := c.do(ctx, http.MethodGet, "/kv?"+q.Encode(), nil, &resp, http.StatusOK); err != nil {
+		return nil, "", err
+	}
+	return resp.Keys, resp.Next, nil
+}
+
+//发送请求，状态码不在expect中时返回StatusError，out不为nil且状态码为200时把body解析到out
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out interface{}, expect ...int) (int, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, r)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		//ctx被取消或者超时是调用方的原因，不算后端不可用
+		if ctx.Err() != nil {
+			return 0, err
+		}
+		return 0, &common.UnavailableError{Backend: "http " + c.base, Err: err}
+	}
+	defer resp.Body.Close()
+
+	ok := false
+	for _, code := range expect {
+		if resp.StatusCode == code {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		var e ErrorResponse
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		if json.Unmarshal(b, &e) != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(b))
+		}
+		return resp.StatusCode, &StatusError{StatusCode: resp.StatusCode, Message: e.Error}
+	}
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("http storage: invalid response body: %v", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func keyPath(k string) string {
+	return "/kv/" + url.PathEscape(k)
+}
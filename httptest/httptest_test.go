@@ -0,0 +1,334 @@
+package httptest
+
+/*
+ * httptest是Golang官方自带的http测试包(net/http/httptest)，主要有两种用法：
+ *   1. httptest.NewRecorder：
+ *        一个实现了http.ResponseWriter的记录器，直接调用handler.ServeHTTP(rec, req)，
+ *        之后检查rec.Code、rec.Header()、rec.Body，不需要监听端口，适合测试服务端handler本身
+ *      httptest.NewRequest用来构造请求，和http.NewRequest不同，出错时直接panic，不需要检查err
+ *   2. httptest.NewServer：
+ *        在本地回环地址上起一个真实的http server，server.URL为它的地址，用完需要Close
+ *        适合测试客户端：已经约定了接口，但是服务端还没实现时，可以用它模拟服务端的各种返回
+ *
+ * 本例：
+ *   NewHandler把StorageClient以REST方式暴露出去，用NewRecorder测试各种状态码
+ *   Client通过HTTP实现了StorageClient，用NewServer测试，包括超时、服务端返回异常的body等
+ */
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hq-cml/go-unittest/common"
+	"github.com/hq-cml/go-unittest/common/storagetest"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func newStore() common.StorageClient {
+	c := common.NewRealClient()
+	c.Set("k1", "v1")
+	c.Set("a/b", "slash")
+	c.Set("movie:1", "Alien")
+	c.Set("movie:2", "Brazil")
+	//err:开头的key读写都会失败
+	return common.NewFaultClient(c, common.FaultConfig{
+		Rules: []common.FaultRule{{Prefix: "err:", ErrorRate: 1}},
+	})
+}
+
+//down:开头的key后端不可用，gone:开头的key后端报告不存在
+func newTypedErrorStore() common.StorageClient {
+	down := common.NewFaultClient(common.NewRealClient(), common.FaultConfig{
+		Rules: []common.FaultRule{{Prefix: "down:", ErrorRate: 1}},
+		Err:   &common.UnavailableError{Backend: "test", Err: errors.New("connection refused")},
+	})
+	return common.NewFaultClient(down, common.FaultConfig{
+		Rules: []common.FaultRule{{Prefix: "gone:", ErrorRate: 1}},
+		Err:   &common.NotFoundError{Key: "gone:1"},
+	})
+}
+
+func TestHandler(t *testing.T) {
+	h := NewHandler(newStore())
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{name: "get", method: "GET", path: "/kv/k1", wantCode: 200, wantBody: `{"key":"k1","value":"v1"}`},
+		{name: "get missing", method: "GET", path: "/kv/missing", wantCode: 404, wantBody: `"error":"key not found"`},
+		{name: "get escaped key", method: "GET", path: "/kv/a%2Fb", wantCode: 200, wantBody: `"value":"slash"`},
+		{name: "head", method: "HEAD", path: "/kv/k1", wantCode: 200},
+		{name: "head missing", method: "HEAD", path: "/kv/missing", wantCode: 404},
+		{name: "put", method: "PUT", path: "/kv/k2", body: `{"value":"v2"}`, wantCode: 204},
+		{name: "put empty value", method: "PUT", path: "/kv/k2", body: `{"value":""}`, wantCode: 204},
+		{name: "put malformed", method: "PUT", path: "/kv/k2", body: `{"value":`, wantCode: 400, wantBody: "invalid body"},
+		{name: "put wrong type", method: "PUT", path: "/kv/k2", body: `{"value":1}`, wantCode: 400, wantBody: "invalid body"},
+		{name: "put missing value", method: "PUT", path: "/kv/k2", body: `{}`, wantCode: 400, wantBody: "missing value"},
+		{name: "put unknown field", method: "PUT", path: "/kv/k2", body: `{"value":"v","ttl":1}`, wantCode: 400, wantBody: "unknown field"},
+		{name: "put trailing data", method: "PUT", path: "/kv/k2", body: `{"value":"v"}{}`, wantCode: 400, wantBody: "trailing data"},
+		{name: "put too large", method: "PUT", path: "/kv/k2", body: `{"value":"` + strings.Repeat("x", maxBodySize) + `"}`, wantCode: 400, wantBody: "invalid body"},
+		{name: "put backend error", method: "PUT", path: "/kv/err:1", body: `{"value":"v"}`, wantCode: 500, wantBody: common.ErrInjected.Error()},
+		{name: "delete", method: "DELETE", path: "/kv/k1", wantCode: 204},
+		{name: "delete missing", method: "DELETE", path: "/kv/missing", wantCode: 204},
+		{name: "delete backend error", method: "DELETE", path: "/kv/err:1", wantCode: 500},
+		{name: "method not allowed", method: "POST", path: "/kv/k1", wantCode: 405},
+		{name: "unknown path", method: "GET", path: "/other", wantCode: 404},
+		{name: "list", method: "GET", path: "/kv?prefix=movie:", wantCode: 200, wantBody: `{"keys":["movie:1","movie:2"],"next":""}`},
+		{name: "list page", method: "GET", path: "/kv?prefix=movie:&limit=1", wantCode: 200, wantBody: `{"keys":["movie:1"],"next":"movie:1\u0000"}`},
+		{name: "list empty", method: "GET", path: "/kv?prefix=nothing", wantCode: 200, wantBody: `{"keys":[],"next":""}`},
+		{name: "list invalid limit", method: "GET", path: "/kv?limit=abc", wantCode: 400, wantBody: "invalid limit"},
+		{name: "list negative limit", method: "GET", path: "/kv?limit=-1", wantCode: 400, wantBody: "invalid limit"},
+		{name: "list backend error", method: "GET", path: "/kv?prefix=err:", wantCode: 500},
+		{name: "list method not allowed", method: "DELETE", path: "/kv", wantCode: 405},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("%s %s code = %d, want %d, body = %s", tt.method, tt.path, rec.Code, tt.wantCode, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s body = %s, want %s", tt.method, tt.path, rec.Body, tt.wantBody)
+			}
+			if rec.Code == 405 && rec.Header().Get("Allow") == "" {
+				t.Errorf("%s %s missing Allow header", tt.method, tt.path)
+			}
+			if tt.wantBody != "" && !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+				t.Errorf("%s %s Content-Type = %s", tt.method, tt.path, rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+//存储返回的错误按类别映射成状态码
+func TestHandlerTypedErrors(t *testing.T) {
+	h := NewHandler(newTypedErrorStore())
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+	}{
+		{name: "unavailable put", method: "PUT", path: "/kv/down:1", body: `{"value":"v"}`, wantCode: 503},
+		{name: "unavailable delete", method: "DELETE", path: "/kv/down:1", wantCode: 503},
+		{name: "unavailable list", method: "GET", path: "/kv?prefix=down:", wantCode: 503},
+		{name: "not found delete", method: "DELETE", path: "/kv/gone:1", wantCode: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.wantCode {
+				t.Errorf("%s %s code = %d, want %d, body = %s", tt.method, tt.path, rec.Code, tt.wantCode, rec.Body)
+			}
+		})
+	}
+
+	//经过HTTP之后，客户端仍然可以用errors.Is判断类别
+	server := httptest.NewServer(h)
+	defer server.Close()
+	client := NewClient(server.URL)
+	if err := client.Set("down:1", "v"); !errors.Is(err, common.ErrBackendUnavailable) {
+		t.Errorf("Set(down:1) error = %v, want ErrBackendUnavailable", err)
+	}
+	if err := client.Delete("gone:1"); !errors.Is(err, common.ErrNotFound) {
+		t.Errorf("Delete(gone:1) error = %v, want ErrNotFound", err)
+	}
+}
+
+//服务端已经关闭
+func TestClientUnavailable(t *testing.T) {
+	server := httptest.NewServer(NewHandler(common.NewRealClient()))
+	client := NewClient(server.URL)
+	server.Close()
+
+	err := client.Set("k1", "v1")
+	if !errors.Is(err, common.ErrBackendUnavailable) {
+		t.Errorf("Set() error = %v, want ErrBackendUnavailable", err)
+	}
+	var ue *common.UnavailableError
+	if !errors.As(err, &ue) || ue.Backend != "http "+server.URL {
+		t.Errorf("Set() error = %#v, want *common.UnavailableError", err)
+	}
+	if _, ok, err := client.GetContext(context.Background(), "k1"); ok || !errors.Is(err, common.ErrBackendUnavailable) {
+		t.Errorf("GetContext() = %v, %v, want ErrBackendUnavailable", ok, err)
+	}
+}
+
+//请求的ctx已经结束时不再访问存储
+func TestHandlerCanceled(t *testing.T) {
+	convey.Convey("TestHandlerCanceled", t, func() {
+		store := common.NewRealClient()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := httptest.NewRequest("PUT", "/kv/k1", strings.NewReader(`{"value":"v1"}`)).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		NewHandler(store).ServeHTTP(rec, req)
+
+		convey.So(rec.Code, convey.ShouldEqual, http.StatusGatewayTimeout)
+		convey.So(store.Exists("k1"), convey.ShouldBeFalse)
+	})
+}
+
+func TestClient(t *testing.T) {
+	convey.Convey("TestClient", t, func() {
+		server := httptest.NewServer(NewHandler(newStore()))
+		defer server.Close()
+		client := NewClient(server.URL + "/")
+
+		convey.Convey("round trip", func() {
+			v, ok := client.Get("k1")
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(v, convey.ShouldEqual, "v1")
+
+			for _, k := range []string{"a/b", "a b", "100%", "q?x=1#y", "电影"} {
+				convey.So(client.Set(k, "value of "+k), convey.ShouldBeNil)
+				v, ok := client.Get(k)
+				convey.So(ok, convey.ShouldBeTrue)
+				convey.So(v, convey.ShouldEqual, "value of "+k)
+			}
+
+			convey.So(client.Delete("k1"), convey.ShouldBeNil)
+			convey.So(client.Exists("k1"), convey.ShouldBeFalse)
+			_, ok = client.Get("k1")
+			convey.So(ok, convey.ShouldBeFalse)
+
+			keys, next, err := client.Scan("movie:", "", 1)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"movie:1"})
+			keys, next, err = client.Scan("movie:", next, 1)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(keys, convey.ShouldResemble, []string{"movie:2"})
+			convey.So(next, convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("error status", func() {
+			err := client.Set("err:1", "v")
+			var se *StatusError
+			convey.So(errors.As(err, &se), convey.ShouldBeTrue)
+			convey.So(se.StatusCode, convey.ShouldEqual, 500)
+			convey.So(se.Message, convey.ShouldEqual, common.ErrInjected.Error())
+
+			_, _, err = client.GetContext(context.Background(), "err:1")
+			convey.So(err, convey.ShouldBeNil) //Get注入的错误表现为未命中
+
+			_, err = NewClient(server.URL + "/prefix").Keys()
+			convey.So(errors.As(err, &se), convey.ShouldBeTrue)
+			convey.So(se.StatusCode, convey.ShouldEqual, 404)
+		})
+	})
+}
+
+//模拟服务端返回各种异常的响应
+func TestClientBadServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr string
+	}{
+		{
+			name: "malformed body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"keys":[`))
+			},
+			wantErr: "invalid response body",
+		},
+		{
+			name: "plain text error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "upstream exploded", http.StatusBadGateway)
+			},
+			wantErr: "502 Bad Gateway: upstream exploded",
+		},
+		{
+			name: "unexpected status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			},
+			wantErr: "202 Accepted",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			_, err := NewClient(server.URL).Keys()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Keys() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+//Set一直阻塞直到release被关闭
+type blockingClient struct {
+	common.StorageClient
+	release chan struct{}
+}
+
+func (c *blockingClient) Set(k, v string) error {
+	<-c.release
+	return c.StorageClient.Set(k, v)
+}
+
+func TestClientTimeout(t *testing.T) {
+	convey.Convey("TestClientTimeout", t, func() {
+		store := &blockingClient{StorageClient: common.NewRealClient(), release: make(chan struct{})}
+		server := httptest.NewServer(NewHandler(store))
+		//server.Close会等待所有请求处理完，需要先放行阻塞的Set
+		defer server.Close()
+		defer close(store.release)
+
+		convey.Convey("client timeout", func() {
+			client := NewClient(server.URL, WithTimeout(50*time.Millisecond))
+			err := client.Set("k1", "v1")
+			convey.So(err, convey.ShouldNotBeNil)
+			var ne net.Error
+			convey.So(errors.As(err, &ne), convey.ShouldBeTrue)
+			convey.So(ne.Timeout(), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("context deadline", func() {
+			client := NewClient(server.URL)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err := client.SetContext(ctx, "k1", "v1")
+			convey.So(errors.Is(err, context.DeadlineExceeded), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("WithTimeout does not modify the shared client", func() {
+			NewClient(server.URL, WithHTTPClient(http.DefaultClient), WithTimeout(time.Second))
+			convey.So(http.DefaultClient.Timeout, convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("nil http client", func() {
+			client := NewClient(server.URL, WithHTTPClient(nil), WithTimeout(50*time.Millisecond))
+			var ne net.Error
+			convey.So(errors.As(client.Set("k1", "v1"), &ne), convey.ShouldBeTrue)
+			convey.So(ne.Timeout(), convey.ShouldBeTrue)
+			convey.So(http.DefaultClient.Timeout, convey.ShouldEqual, 0)
+		})
+	})
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) (common.StorageClient, func()) {
+		server := httptest.NewServer(NewHandler(common.NewRealClient()))
+		return NewClient(server.URL, WithTimeout(5*time.Second)), server.Close
+	})
+}
@@ -1,7 +1,95 @@
 package main
 
-import "fmt"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hq-cml/go-unittest/common"
+)
+
+const usage = `Usage:
+  go-unittest snapshot save [-log path | -redis addr] <snapshot.json>
+  go-unittest snapshot load [-log path | -redis addr] <snapshot.json>
+
+save: 把存储中的数据导出成JSON快照
+load: 用JSON快照替换存储中的数据（比如从fixture初始化测试环境）
+`
+
+//参数错误，已经打印了usage，以状态码2退出
+var errUsage = errors.New("usage")
 
 func main() {
-    fmt.Println("Unittest Demos")
+	if len(os.Args) < 2 {
+		fmt.Println("Unittest Demos")
+		return
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "snapshot":
+		err = runSnapshot(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err == errUsage {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+//关闭client时的错误(比如文件存储最后的Sync失败)也要报告出来，否则数据可能没有落盘
+func runSnapshot(args []string) (err error) {
+	if len(args) == 0 || (args[0] != "save" && args[0] != "load") {
+		fmt.Fprint(os.Stderr, usage)
+		return errUsage
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("snapshot "+action, flag.ContinueOnError)
+	logPath := fs.String("log", "", "文件存储的日志路径")
+	redisAddr := fs.String("redis", "", "RESP服务的地址，如127.0.0.1:6379")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 1 || (*logPath == "") == (*redisAddr == "") {
+		fs.Usage()
+		return errUsage
+	}
+	path := fs.Arg(0)
+
+	var client common.StorageClient
+	var closer io.Closer
+	if *logPath != "" {
+		c, err := common.NewFileStorageClient(*logPath, common.WithCompactInterval(0))
+		if err != nil {
+			return err
+		}
+		client, closer = c, c
+	} else {
+		c, err := common.NewRESPStorageClient(*redisAddr)
+		if err != nil {
+			return err
+		}
+		client, closer = c, c
+	}
+	defer func() {
+		if cerr := closer.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	if action == "save" {
+		return common.SaveSnapshot(client, path)
+	}
+	return common.LoadSnapshot(client, path)
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hq-cml/go-unittest/common"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestRunSnapshot(t *testing.T) {
+	convey.Convey("TestRunSnapshot", t, func() {
+		dir, err := ioutil.TempDir("", "main")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		src := filepath.Join(dir, "src.log")
+		dst := filepath.Join(dir, "dst.log")
+		path := filepath.Join(dir, "snapshot.json")
+
+		convey.Convey("save and load with file storage", func() {
+			c, err := common.NewFileStorageClient(src, common.WithCompactInterval(0))
+			convey.So(err, convey.ShouldBeNil)
+			c.Set("k1", "v1")
+			c.Set("k2", "v2")
+			convey.So(c.Close(), convey.ShouldBeNil)
+
+			convey.So(runSnapshot([]string{"save", "-log", src, path}), convey.ShouldBeNil)
+			convey.So(runSnapshot([]string{"load", "-log", dst, path}), convey.ShouldBeNil)
+
+			c, err = common.NewFileStorageClient(dst, common.WithCompactInterval(0))
+			convey.So(err, convey.ShouldBeNil)
+			defer c.Close()
+			data, err := common.TakeSnapshot(c)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(data, convey.ShouldResemble, map[string]string{"k1": "v1", "k2": "v2"})
+		})
+
+		convey.Convey("errors", func() {
+			convey.So(runSnapshot([]string{"load", "-log", dst, filepath.Join(dir, "missing.json")}), convey.ShouldNotBeNil)
+			convey.So(runSnapshot([]string{"save", "-log", filepath.Join(dir, "missing", "src.log"), path}), convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("usage", func() {
+			//usage打印到os.Stderr，这里不关心内容
+			stderr := os.Stderr
+			os.Stderr, _ = os.Open(os.DevNull)
+			defer func() { os.Stderr = stderr }()
+
+			usages := [][]string{
+				nil,
+				{"dump"},
+				{"save", path},
+				{"save", "-log", src, "-redis", "127.0.0.1:6379", path},
+				{"save", "-log", src},
+				{"load", "-unknown", path},
+			}
+			for _, args := range usages {
+				convey.So(runSnapshot(args), convey.ShouldEqual, errUsage)
+			}
+		})
+	})
+}